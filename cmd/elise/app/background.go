@@ -0,0 +1,113 @@
+package app
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	bgAttr     = "prim-bg"      // set by backgroundScript, url of background image
+	originAttr = "elise-origin" // set to img node appended for background image
+)
+
+// origin of ImgItem
+const (
+	OriginImg        = "img"
+	OriginBackground = "background"
+)
+
+// backgroundScript mark elements having css background image for pic, it's run after
+// the scripts of data file when 'background_images' is set, so the dumped html keeps them.
+// The first url() which is not data uri is used, size is the box of element.
+const backgroundScript = `var urlRe = /url\(\s*(?:"([^"]*)"|'([^']*)'|([^)]*?))\s*\)/g;
+
+[].forEach.call(document.querySelectorAll('body *'), function(el) {
+  if (el.tagName === 'IMG') {
+    return;
+  }
+  var style = window.getComputedStyle(el);
+  // shorthand is not expanded without layout engine
+  var bg = style.backgroundImage || style.background || '';
+  var src = '', m;
+  urlRe.lastIndex = 0;
+  while ((m = urlRe.exec(bg)) !== null) {
+    var u = m[1] || m[2] || m[3] || '';
+    if (u && u.indexOf('data:') !== 0) {
+      src = u;
+      break;
+    }
+  }
+  if (!src) {
+    return;
+  }
+  var rect = el.getBoundingClientRect();
+  el.setAttribute('prim-bg', src);
+  el.setAttribute('prim-width', rect.width);
+  el.setAttribute('prim-height', rect.height);
+  el.setAttribute('prim-top', rect.top);
+  el.setAttribute('prim-left', rect.left);
+});
+
+return {};`
+
+var cssURLRe = regexp.MustCompile(`url\(\s*(?:"([^"]*)"|'([^']*)'|([^)]*?))\s*\)`)
+
+// cssURL return the first url() of css value which is not data uri
+func cssURL(val string) string {
+	for _, m := range cssURLRe.FindAllStringSubmatch(val, -1) {
+		u := m[1] + m[2] + m[3]
+		if u != "" && !strings.HasPrefix(u, "data:") {
+			return u
+		}
+	}
+	return ""
+}
+
+// appendBackgroundImgs append img node to elements with background image, so they are
+// candidates like other images. Elements are marked by backgroundScript, or have background
+// in inline style, whose width and height are read from inline style if not marked.
+func appendBackgroundImgs(doc *goquery.Document) {
+	doc.Find("body *").Each(func(_ int, sel *goquery.Selection) {
+		n := sel.Nodes[0]
+		if n.DataAtom == atom.Img {
+			return
+		}
+		src, _ := getAttr(n, bgAttr)
+		style := parseStyle(n)
+		if src == "" {
+			if src = cssURL(style["background-image"]); src == "" {
+				src = cssURL(style["background"])
+			}
+		}
+		if src == "" {
+			return
+		}
+
+		img := &html.Node{
+			Type:     html.ElementNode,
+			DataAtom: atom.Img,
+			Data:     "img",
+			Attr: []html.Attribute{
+				{Key: "src", Val: src},
+				{Key: originAttr, Val: OriginBackground},
+			},
+		}
+		for _, key := range []string{"prim-top", "prim-left", "prim-width", "prim-height"} {
+			val, _ := getAttr(n, key)
+			v, err := strconv.ParseFloat(val, 64)
+			if (err != nil || v == 0) && (key == "prim-width" || key == "prim-height") {
+				// not marked or no layout, eg: http driver
+				val = strings.TrimSuffix(style[strings.TrimPrefix(key, "prim-")], "px")
+			}
+			if val != "" {
+				img.Attr = append(img.Attr, html.Attribute{Key: key, Val: val})
+			}
+		}
+		n.AppendChild(img)
+	})
+}
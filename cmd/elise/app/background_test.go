@@ -0,0 +1,25 @@
+package app
+
+import "testing"
+
+func TestCSSURL(t *testing.T) {
+	tests := []struct {
+		val  string
+		want string
+	}{
+		{"", ""},
+		{"none", ""},
+		{"url(a.png)", "a.png"},
+		{"url( 'a;b.png' ) no-repeat", "a;b.png"},
+		{`url("http://cdn.example.com/w_100,h_100/a.png")`, "http://cdn.example.com/w_100,h_100/a.png"},
+		{"url(data:image/png;base64,iVBORw0KGgo=)", ""},
+		// data uri is skipped for the next url
+		{"url(data:image/gif;base64,R0lGOD), url('b.jpg')", "b.jpg"},
+		{"linear-gradient(#fff, #000), url(c.jpg)", "c.jpg"},
+	}
+	for _, tt := range tests {
+		if got := cssURL(tt.val); got != tt.want {
+			t.Errorf("cssURL(%q) = %q, want %q", tt.val, got, tt.want)
+		}
+	}
+}
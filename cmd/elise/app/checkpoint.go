@@ -0,0 +1,125 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// checkpoint record lines of data file which have been crawled,
+// one "line\turl" per line, so an interrupted crawl can be resumed
+type checkpoint struct {
+	path string
+	done map[uint64]string // line => url
+	file *os.File
+}
+
+func checkpointPath(filename string) string {
+	return filepath.Join(fEliseOutputDir, filename+".ckpt")
+}
+
+// openCheckpoint load records from existing checkpoint file when resume,
+// otherwise start a new checkpoint
+func openCheckpoint(path string, resume bool) (*checkpoint, error) {
+	c := &checkpoint{path: path, done: make(map[uint64]string)}
+	if !resume {
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		c.file = file
+		return c, nil
+	}
+
+	if err := truncatePartialLine(path); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	sc := bufio.NewScanner(file)
+	for sc.Scan() {
+		fields := strings.SplitN(sc.Text(), "\t", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		line, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		c.done[line] = fields[1]
+	}
+	if err := sc.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	c.file = file
+	return c, nil
+}
+
+// Done check whether the url in line has been crawled,
+// data file may be changed, so url must be the same
+func (c *checkpoint) Done(line uint64, url string) bool {
+	u, ok := c.done[line]
+	return ok && u == url
+}
+
+func (c *checkpoint) Mark(line uint64, url string) error {
+	_, err := fmt.Fprintf(c.file, "%d\t%s\n", line, url)
+	return err
+}
+
+func (c *checkpoint) Close() error {
+	return c.file.Close()
+}
+
+// truncatePartialLine cut the last line without newline, which is left by crash
+// while writing, so records appended later won't be merged into it
+func truncatePartialLine(path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	size := stat.Size()
+	var keep int64
+	buf := make([]byte, 4096)
+	for end := size; end > 0; {
+		n := int64(len(buf))
+		if n > end {
+			n = end
+		}
+		if _, err := file.ReadAt(buf[:n], end-n); err != nil {
+			return err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			keep = end - n + int64(i) + 1
+			break
+		}
+		end -= n
+	}
+	if keep == size {
+		return nil
+	}
+	return file.Truncate(keep)
+}
+
+// scanCompleteLines split like bufio.ScanLines, but drop the last line without newline
+func scanCompleteLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && bytes.IndexByte(data, '\n') < 0 {
+		return len(data), nil, nil
+	}
+	return bufio.ScanLines(data, atEOF)
+}
@@ -0,0 +1,129 @@
+package app
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func appendFile(t *testing.T, path, data string) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckpointResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.txt.ckpt")
+	c, err := openCheckpoint(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Mark(1, "http://a.example.com/")
+	c.Mark(3, "http://c.example.com/")
+	c.Close()
+	// crashed while writing the record of line 4
+	appendFile(t, path, "4\thttp://d.exa")
+
+	c, err = openCheckpoint(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		line uint64
+		url  string
+		want bool
+	}{
+		{1, "http://a.example.com/", true},
+		{3, "http://c.example.com/", true},
+		{2, "http://b.example.com/", false},
+		// data file changed
+		{1, "http://c.example.com/", false},
+		{4, "http://d.exa", false},
+		{4, "http://d.example.com/", false},
+	}
+	for _, tt := range tests {
+		if got := c.Done(tt.line, tt.url); got != tt.want {
+			t.Errorf("Done(%d, %q) = %v, want %v", tt.line, tt.url, got, tt.want)
+		}
+	}
+
+	// records after the partial one are not lost
+	c.Mark(4, "http://d.example.com/")
+	c.Mark(2, "http://b.example.com/")
+	c.Close()
+	c, err = openCheckpoint(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	done := map[uint64]string{
+		1: "http://a.example.com/",
+		2: "http://b.example.com/",
+		3: "http://c.example.com/",
+		4: "http://d.example.com/",
+	}
+	for line, url := range done {
+		if !c.Done(line, url) {
+			t.Errorf("Done(%d, %q) = false after resumed twice, want true", line, url)
+		}
+	}
+	data, _ := ioutil.ReadFile(path)
+	want := "1\thttp://a.example.com/\n3\thttp://c.example.com/\n4\thttp://d.example.com/\n2\thttp://b.example.com/\n"
+	if string(data) != want {
+		t.Errorf("checkpoint file = %q, want %q", data, want)
+	}
+}
+
+func TestCheckpointRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.txt.ckpt")
+	appendFile(t, path, "1\thttp://a.example.com/\n")
+	// records of previous run are dropped without resume
+	c, err := openCheckpoint(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.Done(1, "http://a.example.com/") {
+		t.Error("Done of previous run = true without resume, want false")
+	}
+	if data, _ := ioutil.ReadFile(path); len(data) != 0 {
+		t.Errorf("checkpoint file = %q without resume, want empty", data)
+	}
+}
+
+func TestTruncatePartialLine(t *testing.T) {
+	long := string(make([]byte, 5000))
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"", ""},
+		{"a\n", "a\n"},
+		{"a\nb", "a\n"},
+		{"partial", ""},
+		{"a\nb\n" + long, "a\nb\n"},
+		{"a\n" + long + "\n" + long, "a\n" + long + "\n"},
+	}
+	dir := t.TempDir()
+	for i, tt := range tests {
+		path := filepath.Join(dir, "file")
+		if err := ioutil.WriteFile(path, []byte(tt.data), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := truncatePartialLine(path); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := ioutil.ReadFile(path); string(data) != tt.want {
+			t.Errorf("case %d: truncated to %d bytes, want %d", i, len(data), len(tt.want))
+		}
+	}
+	if err := truncatePartialLine(filepath.Join(dir, "none")); err != nil {
+		t.Errorf("truncatePartialLine of missing file = %v, want nil", err)
+	}
+}
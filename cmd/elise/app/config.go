@@ -0,0 +1,503 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ensonmj/elise/cmd/elise/conf"
+	"github.com/spf13/cast"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	crawlConfFile = "/conf/crawl.yml"
+	picConfFile   = "/conf/pic.yml"
+)
+
+var fConfigScriptDir string
+
+func init() {
+	ConfigCmd.AddCommand(ConfigCheckCmd)
+
+	flags := ConfigCheckCmd.Flags()
+	flags.StringVar(&fConfigScriptDir, "scriptDir", "./script", "dir for storage scripts, to check 'script_name' of crawl.yml")
+}
+
+var ConfigCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage conf files of crawl and pic.",
+}
+
+var ConfigCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check crawl.yml and pic.yml, report all problems with file and line.",
+	Long: `Check crawl.yml and pic.yml, report unknown keys, invalid values and
+missing scripts. Embedded conf files are checked unless in develop mode.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var errs ConfErrors
+		confs, err := loadCrawlConf(fConfigScriptDir)
+		if err != nil {
+			return err
+		}
+		// problems of template are reported once, not for every data file merging it
+		reported := make(map[string]bool)
+		for _, c := range confs {
+			for _, e := range c.Errs {
+				key := fmt.Sprintf("%d\t%s\t%v", e.Line, e.Key, e.Err)
+				if !reported[key] {
+					reported[key] = true
+					errs = append(errs, e)
+				}
+			}
+		}
+		if _, err := loadPicConf(); err != nil {
+			picErrs, ok := err.(ConfErrors)
+			if !ok {
+				return err
+			}
+			errs = append(errs, picErrs...)
+		}
+		if len(errs) == 0 {
+			fmt.Printf("%d data files in %s, no problem found\n", len(confs), crawlConfFile[1:])
+			return nil
+		}
+		sort.SliceStable(errs, func(i, j int) bool {
+			if errs[i].File != errs[j].File {
+				return errs[i].File < errs[j].File
+			}
+			return errs[i].Line < errs[j].Line
+		})
+		for _, e := range errs {
+			fmt.Println(e)
+		}
+		return fmt.Errorf("%d problems found", len(errs))
+	},
+}
+
+// ConfError is a problem of conf located by file and line
+type ConfError struct {
+	File  string
+	Line  int
+	Entry string // data file in crawl.yml
+	Key   string
+	Err   error
+}
+
+func (e *ConfError) Error() string {
+	var where []string
+	for _, s := range []string{e.Entry, e.Key} {
+		if s != "" {
+			where = append(where, s)
+		}
+	}
+	return fmt.Sprintf("%s:%d: %s: %v", e.File, e.Line, strings.Join(where, "."), e.Err)
+}
+
+// ConfErrors is all problems found in conf
+type ConfErrors []*ConfError
+
+func (errs ConfErrors) Error() string {
+	var msgs []string
+	for _, e := range errs {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// confEntry is a key of yaml mapping with its value
+type confEntry struct {
+	Key   string
+	Node  *yaml.Node // key node, for line number
+	Value *yaml.Node
+}
+
+// readConfNode read conf file as yaml node, it's a mapping
+func readConfNode(name string) (*yaml.Node, error) {
+	data, err := conf.FSByte(fEliseDevMode, name)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", name[1:], err)
+	}
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode}, nil
+	}
+	return doc.Content[0], nil
+}
+
+// mappingEntries list keys of mapping node, aliases are resolved and keys merged
+// by '<<' are overridden by keys of the mapping, just like yaml decoding
+func mappingEntries(node *yaml.Node) ([]confEntry, error) {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("should be a mapping")
+	}
+	var entries, merged []confEntry
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		k, v := node.Content[i], node.Content[i+1]
+		if k.Tag != "!!merge" {
+			entries = append(entries, confEntry{Key: k.Value, Node: k, Value: v})
+			seen[k.Value] = true
+			continue
+		}
+		// the first mapping wins if a key is merged from several mappings
+		sources := []*yaml.Node{v}
+		if v.Kind == yaml.SequenceNode {
+			sources = v.Content
+		}
+		for _, src := range sources {
+			sub, err := mappingEntries(src)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: merged value %v", k.Line, err)
+			}
+			merged = append(merged, sub...)
+		}
+	}
+	for _, e := range merged {
+		if !seen[e.Key] {
+			entries = append(entries, e)
+			seen[e.Key] = true
+		}
+	}
+	return entries, nil
+}
+
+// decodeValue decode yaml node as generic value for parsers of each key
+func decodeValue(node *yaml.Node) (interface{}, error) {
+	var val interface{}
+	if err := node.Decode(&val); err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+// CrawlConf is the conf of one data file in crawl.yml
+type CrawlConf struct {
+	Name             string
+	Line             int
+	Template         bool // entry with anchor, it's merged by others and not a data file
+	Ignore           bool
+	DumpHTML         bool
+	Screenshot       string // "viewport" or "fullpage", empty means no screenshot
+	Network          string
+	BackgroundImages bool // mark elements with background image for pic
+	Follow           *FollowRule
+	Dedup            *Canonicalizer
+	Driver           string
+	Proxy            *ProxyPool
+	Profile          *Profile
+	HostLimit        HostLimit
+	Retry            RetryPolicy
+	Timeouts         Timeouts
+	ScriptNames      []string
+	Fields           []Field
+	FieldsJS         string
+	Input            *SeedFormat
+	OutputFormat     string
+	OutputFile       string
+
+	Errs ConfErrors // the data file is skipped if any
+}
+
+var crawlConfKeys = []string{"ignore", "dump_html", "screenshot", "network", "background_images", "follow", "dedup",
+	"driver", "proxy", "device", "user_agent", "viewport", "headers", "cookies", "locale", "timezone",
+	"host_rate", "host_burst", "host_concurrency", "retry", "page_load_timeout", "script_timeout",
+	"url_timeout", "script_name", "fields", "input", "output_format", "output_file"}
+
+// loadCrawlConf read conf of all data files in crawl.yml, problems are kept by each conf,
+// error is returned only if crawl.yml can't be read
+func loadCrawlConf(scriptDir string) ([]*CrawlConf, error) {
+	root, err := readConfNode(crawlConfFile)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := mappingEntries(root)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", crawlConfFile[1:], err)
+	}
+	var confs []*CrawlConf
+	for _, e := range entries {
+		confs = append(confs, parseCrawlConf(e, scriptDir))
+	}
+	return confs, nil
+}
+
+// loadCrawlConfs read crawl.yml for crawl, all problems are reported before crawling,
+// data files with invalid conf are skipped. Names of data file are case insensitive as before.
+func loadCrawlConfs() error {
+	confs, err := loadCrawlConf(fCrawlScriptDir)
+	if err != nil {
+		return err
+	}
+	crawlConfs = make(map[string]*CrawlConf)
+	for _, c := range confs {
+		for _, e := range c.Errs {
+			log.WithField("err", e).Warn("Invalid conf")
+		}
+		crawlConfs[strings.ToLower(c.Name)] = c
+	}
+	return nil
+}
+
+// parseCrawlConf parse conf of one data file, defaults are from flags of crawl
+func parseCrawlConf(entry confEntry, scriptDir string) *CrawlConf {
+	c := &CrawlConf{
+		Name:         entry.Key,
+		Line:         entry.Node.Line,
+		Template:     entry.Value.Anchor != "",
+		Driver:       fCrawlDriver,
+		Proxy:        crawlProxyPool,
+		OutputFormat: fCrawlOutputFormat,
+		HostLimit: HostLimit{
+			Rate:           fCrawlHostRate,
+			Burst:          fCrawlHostBurst,
+			MaxConcurrency: fCrawlHostConcurrency,
+		},
+		Retry: defaultRetryPolicy(),
+		Timeouts: Timeouts{
+			PageLoad: fCrawlPageLoadTimeout,
+			Script:   fCrawlScriptTimeout,
+			URL:      fCrawlURLTimeout,
+		},
+		Input: &SeedFormat{Format: "lines"},
+	}
+	fail := func(node *yaml.Node, key string, err error) {
+		c.Errs = append(c.Errs, &ConfError{
+			File:  crawlConfFile[1:],
+			Line:  node.Line,
+			Entry: c.Name,
+			Key:   key,
+			Err:   err,
+		})
+	}
+
+	entries, err := mappingEntries(entry.Value)
+	if err != nil {
+		fail(entry.Node, "", err)
+		return c
+	}
+	known := make(map[string]bool)
+	for _, key := range crawlConfKeys {
+		known[key] = true
+	}
+	device := make(map[string]interface{})
+	var deviceNode, proxyNode *yaml.Node
+	var hasScript, hasFields bool
+	for _, e := range entries {
+		if !known[e.Key] {
+			fail(e.Node, e.Key, fmt.Errorf("unknown key"))
+			continue
+		}
+		val, err := decodeValue(e.Value)
+		if err != nil {
+			fail(e.Node, e.Key, err)
+			continue
+		}
+		switch e.Key {
+		case "ignore":
+			c.Ignore, err = cast.ToBoolE(val)
+		case "dump_html":
+			c.DumpHTML, err = cast.ToBoolE(val)
+		case "screenshot":
+			// true for viewport or 'fullpage'
+			switch val := val.(type) {
+			case bool:
+				if val {
+					c.Screenshot = "viewport"
+				}
+			case string:
+				if val != "fullpage" {
+					err = fmt.Errorf("should be true, false or fullpage")
+				}
+				c.Screenshot = val
+			default:
+				err = fmt.Errorf("should be true, false or fullpage")
+			}
+		case "network":
+			c.Network, _ = val.(string)
+			if c.Network != "compact" && c.Network != "har" {
+				err = fmt.Errorf("should be compact or har")
+			}
+		case "background_images":
+			c.BackgroundImages, err = cast.ToBoolE(val)
+		case "follow":
+			c.Follow, err = parseFollowRule(val)
+		case "dedup":
+			c.Dedup, err = parseCanonicalizer(val)
+		case "driver":
+			c.Driver, _ = val.(string)
+			if _, ok := driverCreators[c.Driver]; !ok {
+				err = fmt.Errorf("unknown driver %v, should be one of %v", val, driverNames())
+			}
+		case "proxy":
+			c.Proxy, err = parseProxyPool(val)
+			proxyNode = e.Node
+		case "device", "user_agent", "viewport", "headers", "cookies", "locale", "timezone":
+			// checked one by one to locate the invalid key
+			if _, err = parseProfile(map[string]interface{}{e.Key: val}); err == nil {
+				device[e.Key] = val
+				if deviceNode == nil {
+					deviceNode = e.Node
+				}
+			}
+		case "host_rate":
+			c.HostLimit.Rate, err = cast.ToFloat64E(val)
+		case "host_burst":
+			c.HostLimit.Burst, err = cast.ToIntE(val)
+		case "host_concurrency":
+			c.HostLimit.MaxConcurrency, err = cast.ToIntE(val)
+		case "retry":
+			c.Retry, err = parseRetryPolicy(val)
+		case "page_load_timeout":
+			if c.Timeouts.PageLoad, err = cast.ToDurationE(val); err == nil && c.Timeouts.PageLoad <= 0 {
+				err = fmt.Errorf("should be a positive duration")
+			}
+		case "script_timeout":
+			if c.Timeouts.Script, err = cast.ToDurationE(val); err == nil && c.Timeouts.Script <= 0 {
+				err = fmt.Errorf("should be a positive duration")
+			}
+		case "url_timeout":
+			if c.Timeouts.URL, err = cast.ToDurationE(val); err == nil && c.Timeouts.URL < 0 {
+				err = fmt.Errorf("should not be negative")
+			}
+		case "script_name":
+			hasScript = true
+			if c.ScriptNames, err = parseScriptNames(val); err == nil {
+				err = checkScripts(scriptDir, c.ScriptNames)
+			}
+		case "fields":
+			hasFields = true
+			if c.Fields, err = parseFields(val); err == nil {
+				c.FieldsJS, err = fieldsScript(c.Fields)
+			}
+		case "input":
+			c.Input, err = parseSeedFormat(val)
+		case "output_format":
+			c.OutputFormat, _ = val.(string)
+			if _, ok := sinkFormats[c.OutputFormat]; !ok {
+				err = fmt.Errorf("unknown format %v, should be one of %v", val, sinkFormatNames())
+			}
+		case "output_file":
+			c.OutputFile, err = cast.ToStringE(val)
+		}
+		if err != nil {
+			fail(e.Node, e.Key, err)
+		}
+	}
+	if deviceNode != nil {
+		if c.Profile, err = parseProfile(device); err != nil {
+			fail(deviceNode, "device", err)
+		}
+	}
+
+	// chrome would fail every page with the proxy, it's driver_crash and never marks proxy unhealthy
+	if c.Driver == "chrome" && c.Proxy.hasUserInfo() {
+		node := entry.Node // proxy of --proxy
+		if proxyNode != nil {
+			node = proxyNode
+		}
+		fail(node, "proxy", fmt.Errorf("chrome can't use proxy with credentials"))
+	}
+
+	// templates may be partial, they are checked by data files merging them
+	if !c.Template && !c.Ignore && !hasScript && !hasFields {
+		fail(entry.Node, "", fmt.Errorf("neither 'script_name' nor 'fields' is set"))
+	}
+	return c
+}
+
+// parseScriptNames read 'script_name', it's a script or list of scripts
+func parseScriptNames(val interface{}) ([]string, error) {
+	switch val := val.(type) {
+	case string:
+		return []string{val}, nil
+	case []interface{}:
+		var names []string
+		for _, v := range val {
+			name, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("should be string or array of string")
+			}
+			names = append(names, name)
+		}
+		return names, nil
+	}
+	return nil, fmt.Errorf("should be string or array of string")
+}
+
+func checkScripts(scriptDir string, names []string) error {
+	var missing []string
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join(scriptDir, name)); err != nil {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("scripts not found in %s: %v", scriptDir, missing)
+	}
+	return nil
+}
+
+// PicConf is the conf of pic in pic.yml
+type PicConf struct {
+	BlackWordsInTitle    []string `yaml:"black_words_in_title"`
+	PostTrimPrefixSuffix string   `yaml:"post_trim_prefix_suffix"`
+	Score                *Scorer  `yaml:"score"`
+	LazyAttrs            []string `yaml:"lazy_attrs"`
+}
+
+// loadPicConf read pic.yml, ConfErrors is returned for unknown keys and invalid values
+func loadPicConf() (*PicConf, error) {
+	root, err := readConfNode(picConfFile)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := mappingEntries(root)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", picConfFile[1:], err)
+	}
+	c := &PicConf{Score: defaultScorer(), LazyAttrs: defaultLazyAttrs}
+	var errs ConfErrors
+	for _, e := range entries {
+		switch e.Key {
+		case "black_words_in_title":
+			err = e.Value.Decode(&c.BlackWordsInTitle)
+		case "post_trim_prefix_suffix":
+			err = e.Value.Decode(&c.PostTrimPrefixSuffix)
+		case "score":
+			var val interface{}
+			if val, err = decodeValue(e.Value); err == nil {
+				c.Score, err = parseScorer(val)
+			}
+		case "lazy_attrs":
+			if err = e.Value.Decode(&c.LazyAttrs); err == nil && len(c.LazyAttrs) == 0 {
+				err = fmt.Errorf("should not be empty")
+			}
+		default:
+			err = fmt.Errorf("unknown key")
+		}
+		if err != nil {
+			errs = append(errs, &ConfError{
+				File: picConfFile[1:],
+				Line: e.Node.Line,
+				Key:  e.Key,
+				Err:  err,
+			})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return c, nil
+}
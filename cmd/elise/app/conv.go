@@ -132,11 +132,12 @@ func conv() error {
 	m := newConvProcessor(fConvTmplSafe)
 	fw := newTmplWrapper(fConvTmplSafe)
 	if fEliseInPath == "-" {
-		return fileproc.ProcTerm(fEliseParallel, fEliseBufMaxSize, m, nil, fw)
+		return fileproc.ProcTerm(fEliseParallel, fEliseBufMaxSize, newCountedMapper("conv", m), nil, fw)
 	}
-	fp := fileproc.NewFileProcessor(fEliseParallel, fEliseBufMaxSize, fEliseSplitCnt, true, false, m, nil, fw)
+	fp := fileproc.NewFileProcessor(fEliseParallel, fEliseBufMaxSize, fEliseSplitCnt, true, false, newCountedMapper("conv", m), nil, fw)
 	err := fp.ProcPath(fEliseInPath, fEliseOutputDir, fConvFileExt)
 	i, mc, r := fp.Stat()
+	metricFileprocReduceOut.WithLabelValues("conv").Add(float64(r))
 	logrus.WithFields(logrus.Fields{
 		"inputLineCnt": i,
 		"mapOutCnt":    mc,
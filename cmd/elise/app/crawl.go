@@ -2,54 +2,113 @@ package app
 
 import (
 	"bufio"
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
-	"github.com/ensonmj/elise/cmd/elise/conf"
-	"github.com/sclevine/agouti"
+	"github.com/spf13/cast"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 	"golang.org/x/sync/errgroup"
 )
 
 var (
 	fCrawlScriptDir string
+	fCrawlDriver    string
+	fCrawlResume    bool
+
+	fCrawlOutputFormat string
+	fCrawlProxy        []string
+
+	// proxies from --proxy, shared by data files without 'proxy' conf
+	crawlProxyPool *ProxyPool
+	crawlConfs     map[string]*CrawlConf // lower case name of data file => conf
+
+	fCrawlShutdownTimeout time.Duration
+	fCrawlPageLoadTimeout time.Duration
+	fCrawlScriptTimeout   time.Duration
+	fCrawlURLTimeout      time.Duration
+	fCrawlProgress        time.Duration
+	fCrawlHostRate        float64
+	fCrawlHostBurst       int
+	fCrawlHostConcurrency int
 )
 
 func init() {
 	flags := CrawlCmd.Flags()
 	flags.StringVar(&fCrawlScriptDir, "scriptDir", "./script", "dir for storage scripts")
+	flags.StringVar(&fCrawlDriver, "driver", "phantomjs", "default driver: chrome, http, phantomjs, can be overridden by 'driver' in conf")
+	flags.BoolVar(&fCrawlResume, "resume", false, "skip urls recorded in checkpoint, and append to existing output files")
+	flags.StringSliceVar(&fCrawlProxy, "proxy", nil, "http or socks5 proxies rotated by all sessions, eg: socks5://127.0.0.1:1080, can be overridden by 'proxy' in conf")
+	flags.StringVar(&fCrawlOutputFormat, "outputFormat", "tsv", "default output format: jsonl, jsonl.gz, sqlite, tsv, tsv.gz, can be overridden by 'output_format' in conf")
+	flags.DurationVar(&fCrawlProgress, "progress", 30*time.Second, "interval of printing progress to stderr, 0 means never")
+	flags.DurationVar(&fCrawlPageLoadTimeout, "pageLoadTimeout", 300*time.Second, "max time to navigate, can be overridden by 'page_load_timeout' in conf")
+	flags.DurationVar(&fCrawlScriptTimeout, "scriptTimeout", 30*time.Second, "max time to run one script, can be overridden by 'script_timeout' in conf")
+	flags.DurationVar(&fCrawlURLTimeout, "urlTimeout", 0, "max time for one url, the driver is restarted when exceeded, 0 means no limit, can be overridden by 'url_timeout' in conf")
+	flags.DurationVar(&fCrawlShutdownTimeout, "shutdownTimeout", time.Minute, "max time to wait for running urls after SIGINT/SIGTERM")
+	flags.Float64Var(&fCrawlHostRate, "hostRate", 0, "max requests per second for each host, 0 means no limit, can be overridden by 'host_rate' in conf")
+	flags.IntVar(&fCrawlHostBurst, "hostBurst", 1, "max burst requests for each host, can be overridden by 'host_burst' in conf")
+	flags.IntVar(&fCrawlHostConcurrency, "hostConcurrency", 0, "max running pages for each host, 0 means no limit, can be overridden by 'host_concurrency' in conf")
 }
 
 type FileInfo struct {
-	Filename string
-	Line     uint64
-	Start    time.Time
-	Done     *sync.WaitGroup // just include parse, exclude write file
+	Filename   string
+	Lines      uint64 // lines in data file when started, for ETA
+	Line       uint64
+	Skipped    uint64 // already crawled according to checkpoint
+	Duplicated uint64 // seen in data file or output of previous run
+	Dispatched uint64
+	Running    uint64
+	Completed  uint64 // result has been written
+	Empty      uint64 // completed without result
+	Retried    uint64
+	Failed     uint64 // retries exhausted, written to failed file
+	TimedOut   uint64 // failed by timeout, included in Failed
+	Invalid    uint64 // lines can't be parsed as seed
+	Start      time.Time
+	End        int64           // unix nano when output is closed, 0 while running
+	Done       *sync.WaitGroup // just include parse, exclude write file
 }
 
 type URLRes struct {
-	URL string
-	Res map[string]interface{}
+	URL     string
+	Line    uint64
+	Res     map[string]interface{} // nil when no result need to be written
+	Err     error                  // not nil when retries are exhausted
+	Attempt int
+	Meta    map[string]interface{} // metadata of seed, written next to result
 }
 
 type URLInfo struct {
-	URL      string
-	JsFuncs  []string
-	DumpHTML bool
-	ResChan  chan URLRes
-	FInfo    *FileInfo
+	URL        string
+	Line       uint64 // line number in data file, start from 1, 0 for urls found by following links
+	Driver     string
+	Profile    *Profile   // device to emulate, nil means the driver default
+	Proxy      *ProxyPool // nil means direct
+	JsFuncs    []string
+	DumpHTML   bool
+	Screenshot string // screenshot mode: "viewport" or "fullpage", empty means no screenshot
+	Network    string // network capture mode: "compact" or "har", empty means no capture
+	HostLimit  HostLimit
+	Retry      RetryPolicy
+	Timeouts   Timeouts
+	Attempt    int // start from 1
+	Follow     *FollowRule
+	Depth      int // depth of following links, 0 for urls in data file
+	SeedURL    string
+	Seed       *followSeed
+	Seen       *seenSet               // shared by urls of one data file
+	Meta       map[string]interface{} // metadata of seed, inherited by followed links
+	ResChan    chan URLRes
+	FInfo      *FileInfo
 }
 
 var CrawlCmd = &cobra.Command{
@@ -68,143 +127,275 @@ var CrawlCmd = &cobra.Command{
 			}).Fatal("No data dir")
 			return err
 		}
-		data, err := conf.FSByte(fEliseDevMode, "/conf/crawl.yml")
-		if err != nil {
-			return err
+		if _, ok := driverCreators[fCrawlDriver]; !ok {
+			return fmt.Errorf("unknown driver %q, should be one of %v", fCrawlDriver, driverNames())
 		}
-		viper.SetConfigType("yml")
-		err = viper.ReadConfig(bytes.NewReader(data))
-		if err != nil {
-			return err
+		if _, ok := sinkFormats[fCrawlOutputFormat]; !ok {
+			return fmt.Errorf("unknown output format %q, should be one of %v", fCrawlOutputFormat, sinkFormatNames())
 		}
-		return nil
+		if len(fCrawlProxy) > 0 {
+			var err error
+			if crawlProxyPool, err = newProxyPool(fCrawlProxy); err != nil {
+				return err
+			}
+		}
+		return loadCrawlConfs()
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return mainFunc()
 	},
 }
 
+// crawlRun hold states shared by all workers and data files in one crawl
+type crawlRun struct {
+	ctx     context.Context // canceled while shutting down, stop dispatching urls
+	abort   chan struct{}   // closed when giving up waiting for running urls
+	writers sync.WaitGroup
+
+	mu    sync.Mutex // guard files, they are read by progress reporter
+	files []*FileInfo
+}
+
+func (run *crawlRun) addFile(fi *FileInfo) {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	run.files = append(run.files, fi)
+}
+
+func (run *crawlRun) fileList() []*FileInfo {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	return append([]*FileInfo(nil), run.files...)
+}
+
 func mainFunc() error {
 	var infoeg errgroup.Group
-	var retryeg errgroup.Group
 
-	infoChan := make(chan URLInfo, fEliseParallel)
-	retryNum := fEliseParallel/2 + 1
-	retryChan := make(chan URLInfo, retryNum)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	run := &crawlRun{ctx: ctx, abort: make(chan struct{})}
+	start := time.Now()
+	if fCrawlProgress > 0 {
+		stopProgress := make(chan struct{})
+		defer close(stopProgress)
+		go reportProgress(run, fCrawlProgress, stopProgress)
+	}
+
+	// first signal stop dispatching new urls, the second one abort running urls
+	forceChan := make(chan struct{})
+	sigChan := make(chan os.Signal, 2)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+	go func() {
+		sig := <-sigChan
+		log.WithField("signal", sig).Warn("Receive signal, stop dispatching new urls")
+		fmt.Fprintf(os.Stderr, "Receive %v, wait at most %v for running urls, repeat to abort\n",
+			sig, fCrawlShutdownTimeout)
+		cancel()
+		<-sigChan
+		close(forceChan)
+	}()
+
+	// read ahead, so urls of other hosts can be dispatched while some hosts are blocked,
+	// failed urls are pushed back to the same scheduler after backoff
+	sched := newHostScheduler(ctx, newHostStates(), fEliseParallel*10)
 	for i := 0; i < fEliseParallel; i++ {
 		index := i
 		infoeg.Go(func() error {
-		RESTART:
-			driver := agouti.PhantomJS()
-			if err := driver.Start(); err != nil {
-				log.WithFields(log.Fields{
-					"index": index,
-					"err":   err,
-				}).Fatalf("Failed to start driver:%v", err)
-				return err
-			}
 			log.WithField("index", index).Debug("Success to start worker")
+			defer log.WithField("index", index).Debug("Worker exit")
 
-			for {
-				select {
-				case info, ok := <-infoChan:
-					if !ok {
-						log.WithField("index", index).Debug("Worker exit")
-						driver.Stop()
-						return nil
-					}
+			return crawlWorker(run, index, sched)
+		})
+	}
 
-					err := parseURL(index, info, driver)
-					if err != nil {
-						// sometimes phantomjs crashed or just navigate timeout
-						// we can't differentiate cause of errors
-						// so we just restart the worker and push the *info* to retry queue
-						log.WithFields(log.Fields{
-							"index": index,
-							"info":  info,
-						}).Warn("Failed to parse, will retry later")
-						go func(info URLInfo) {
-							time.Sleep(10 * time.Second)
-							retryChan <- info
-						}(info)
-
-						driver.Stop()
-						goto RESTART
-					}
+	log.WithField("dataDir", fEliseInPath).Debug("Start to traversal data files")
+	err := filepath.Walk(fEliseInPath, walkFile(run, sched))
+	sched.Close()
+
+	finished := make(chan struct{})
+	go func() {
+		infoeg.Wait()
+		run.writers.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		select {
+		case <-finished:
+		case <-time.After(fCrawlShutdownTimeout):
+			log.WithField("timeout", fCrawlShutdownTimeout).Warn("Timeout to wait for running urls")
+		case <-forceChan:
+			log.Warn("Abort running urls")
+		}
+		// writers save results received, drivers are stopped to unblock workers
+		close(run.abort)
+		stopStartedDrivers()
+		run.writers.Wait()
+	}
+	log.Debug("Finish all tasks")
+	printSummary(run.fileList())
+	if err := writeSummary(run.fileList(), start, ctx.Err() != nil); err != nil {
+		log.WithField("err", err).Warn("Failed to write summary")
+	}
+
+	if err != nil && err != context.Canceled {
+		return err
+	}
+	return nil
+}
+
+// crawlWorker parse urls from sched until it's closed,
+// failed urls are retried according to the retry policy of data file
+func crawlWorker(run *crawlRun, index int, sched *hostScheduler) error {
+	drivers := make(workerDrivers)
+	defer drivers.stopAll()
+
+	for {
+		info, ok := sched.Pop()
+		if !ok {
+			return nil
+		}
+		if run.ctx.Err() != nil {
+			// shutting down, abandon urls not started
+			sched.Release(info)
+			sched.Finish()
+			info.FInfo.Done.Done()
+			continue
+		}
 
-					log.WithField("url", info.URL).Info("Success to parse")
-					info.FInfo.Done.Done()
+		var res map[string]interface{}
+		var links []string
+		driver, err := drivers.get(index, info.Driver)
+		if err != nil {
+			// fail the url instead of exiting, so results are still flushed and summarized
+			log.WithFields(log.Fields{
+				"index":  index,
+				"driver": info.Driver,
+				"err":    err,
+			}).Warn("Failed to start driver")
+			err = newParseError(ErrDriverCrash, err)
+			sched.Release(info)
+		} else {
+			var proxy *url.URL
+			if info.Proxy != nil {
+				proxy = info.Proxy.Pick()
+			}
+			atomic.AddUint64(&info.FInfo.Running, 1)
+			start := time.Now()
+			ctx, cancel := context.Background(), context.CancelFunc(func() {})
+			if info.Timeouts.URL > 0 {
+				ctx, cancel = context.WithTimeout(ctx, info.Timeouts.URL)
+			}
+			res, links, err = parseURLWithin(ctx, func() {
+				drivers.stop(info.Driver)
+			}, index, info, driver, proxy)
+			cancel()
+			observePage(info, start, err)
+			atomic.AddUint64(&info.FInfo.Running, ^uint64(0))
+			sched.Release(info)
+			if info.Proxy != nil {
+				info.Proxy.Report(proxy, err)
+			}
+		}
+		if err != nil {
+			kind := errKindOf(err)
+			if kind != ErrEmptyResult {
+				// the driver may be broken, restart it when used next time
+				drivers.stop(info.Driver)
+				metricDriverRestarts.WithLabelValues(info.Driver).Inc()
+			}
+			if info.Retry.ShouldRetry(kind, info.Attempt) {
+				delay := info.Retry.Delay(info.Attempt)
+				log.WithFields(log.Fields{
+					"index":   index,
+					"url":     info.URL,
+					"attempt": info.Attempt,
+					"delay":   delay,
+					"err":     err,
+				}).Warn("Failed to parse, will retry later")
+				info.Attempt++
+				atomic.AddUint64(&info.FInfo.Retried, 1)
+				metricRetries.WithLabelValues(string(kind)).Inc()
+				if sched.Retry(info, delay) {
+					continue
 				}
+				// abandoned while shutting down
+				sched.Finish()
+				info.FInfo.Done.Done()
+				continue
 			}
-		})
-	}
-	for i := 0; i < retryNum; i++ {
-		index := i
-		retryeg.Go(func() error {
-		RESTART:
-			driver := agouti.PhantomJS()
-			if err := driver.Start(); err != nil {
+			if kind == ErrEmptyResult && !info.Retry.RetryOn[kind] {
+				// empty result is not an error unless it should be retried
+				err = nil
+			} else {
 				log.WithFields(log.Fields{
-					"index": index,
-					"err":   err,
-				}).Fatalf("Failed to start driver:%v", err)
-				return err
+					"url":     info.URL,
+					"attempt": info.Attempt,
+					"err":     err,
+				}).Info("Failed to parse, give up")
 			}
-			log.WithField("index", index).Debug("Success to start retry worker")
+		} else {
+			log.WithField("url", info.URL).Info("Success to parse")
+		}
 
-			for {
-				select {
-				case info, ok := <-retryChan:
-					if !ok {
-						log.WithField("index", index).Debug("Retry worker exit")
-						driver.Stop()
-						return nil
-					}
-					err := parseURL(index, info, driver)
-					if err != nil {
-						// failed to retry, no more retry for this url, just mark completed
-						log.WithField("url", info.URL).Info("Failed to retry")
-						info.FInfo.Done.Done()
-
-						// we need restart retry worker
-						driver.Stop()
-						goto RESTART
-					}
-					log.WithField("url", info.URL).Info("Success to parse")
-					info.FInfo.Done.Done()
-				}
-			}
-		})
+		if err == nil {
+			followLinks(sched, info, links)
+		}
+		info.ResChan <- URLRes{URL: info.URL, Line: info.Line, Res: res, Err: err, Attempt: info.Attempt, Meta: info.Meta}
+		sched.Finish()
+		info.FInfo.Done.Done()
 	}
+}
 
-	log.WithField("dataDir", fEliseInPath).Debug("Start to traversal data files")
-	err := filepath.Walk(fEliseInPath, walkFile(infoChan))
-	close(infoChan)
-	infoeg.Wait()
-	close(retryChan)
-	retryeg.Wait()
-	log.Debug("Finish all tasks")
-
-	if err != nil {
-		return err
+// followLinks push links found in page to sched, they are crawled just like urls in data file
+func followLinks(sched *hostScheduler, parent URLInfo, links []string) {
+	if parent.Follow == nil || len(links) == 0 {
+		return
+	}
+	for _, link := range parent.Follow.Filter(parent, links) {
+		child := parent
+		child.URL = link
+		child.Line = 0
+		child.Depth = parent.Depth + 1
+		child.Attempt = 1
+		child.FInfo.Done.Add(1)
+		if !sched.Add(child) {
+			child.FInfo.Done.Done()
+			return
+		}
+		atomic.AddUint64(&child.FInfo.Dispatched, 1)
+		log.WithFields(log.Fields{
+			"url":    link,
+			"parent": parent.URL,
+			"depth":  child.Depth,
+		}).Debug("Follow link")
 	}
-	return nil
 }
 
-func parseURL(index int, info URLInfo, driver *agouti.WebDriver) error {
-	page, err := driver.NewPage(agouti.Browser("phantomjs"))
+// parseURL return nil result when script stop parsing, and links need to be followed,
+// errors are classified by parseError so they can be retried differently
+func parseURL(index int, info URLInfo, driver Driver, proxy *url.URL) (map[string]interface{}, []string, error) {
+	page, err := newPage(driver, proxy)
 	if err != nil {
 		log.WithFields(log.Fields{
-			"index": index,
-			"err":   err,
+			"index":  index,
+			"driver": info.Driver,
+			"err":    err,
 		}).Warn("Failed to create session")
-		return err
+		return nil, nil, newParseError(ErrDriverCrash, err)
 	}
 	defer page.Destroy()
 
-	page.Session().SetPageLoad(300000)
-	page.Session().SetScriptTimeout(30000)
-	page.Session().SetImplicitWait(0)
+	if err := setTimeouts(page, info.Timeouts); err != nil {
+		log.WithFields(log.Fields{
+			"index":  index,
+			"driver": info.Driver,
+			"err":    err,
+		}).Warn("Failed to set timeouts")
+		return nil, nil, newParseError(ErrDriverCrash, err)
+	}
 
 	url := info.URL
 	log.WithFields(log.Fields{
@@ -212,6 +403,18 @@ func parseURL(index int, info URLInfo, driver *agouti.WebDriver) error {
 		"url":   url,
 	}).Debug("Get target url")
 
+	// device must be emulated before navigate
+	if info.Profile != nil {
+		if err := emulate(page, info.Profile, url); err != nil {
+			log.WithFields(log.Fields{
+				"index": index,
+				"url":   url,
+				"err":   err,
+			}).Warn("Failed to emulate device")
+			return nil, nil, newParseError(ErrDriverCrash, err)
+		}
+	}
+
 	// this step may be blocked until 'page load' timeout
 	if err := page.Navigate(url); err != nil {
 		log.WithFields(log.Fields{
@@ -219,7 +422,10 @@ func parseURL(index int, info URLInfo, driver *agouti.WebDriver) error {
 			"url":   url,
 			"err":   err,
 		}).Warn("Failed to navigate to target url")
-		return err
+		if isTimeout(err) {
+			return nil, nil, newParseError(ErrNavigateTimeout, err)
+		}
+		return nil, nil, newParseError(ErrNavigate, err)
 	}
 	log.WithFields(log.Fields{
 		"index": index,
@@ -236,7 +442,10 @@ func parseURL(index int, info URLInfo, driver *agouti.WebDriver) error {
 				"scriptIndex": i,
 				"err":         err,
 			}).Warn("Failed to run script")
-			return err
+			if isTimeout(err) {
+				return nil, nil, newParseError(ErrScriptTimeout, err)
+			}
+			return nil, nil, newParseError(ErrScript, err)
 		}
 		log.WithFields(log.Fields{
 			"index":       index,
@@ -246,9 +455,42 @@ func parseURL(index int, info URLInfo, driver *agouti.WebDriver) error {
 		}).Debug("Get parse result")
 
 		if val, ok := res["stop"]; ok && val.(bool) {
-			return nil
+			return nil, pageLinks(index, page, info), nil
+		}
+
+		conds, err := popWaitConds(res)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"index":       index,
+				"url":         url,
+				"scriptIndex": i,
+				"err":         err,
+			}).Warn("Invalid wait condition")
+			return nil, nil, newParseError(ErrScript, err)
+		}
+		if len(conds) > 0 {
+			delete(res, "stop")
+		}
+		for _, cond := range conds {
+			start := time.Now()
+			if err := waitFor(page, cond); err != nil {
+				log.WithFields(log.Fields{
+					"index": index,
+					"url":   url,
+					"cond":  cond,
+					"err":   err,
+				}).Warn("Failed to wait for condition")
+				return nil, nil, err
+			}
+			log.WithFields(log.Fields{
+				"index":   index,
+				"url":     url,
+				"cond":    cond,
+				"elapsed": time.Since(start),
+			}).Debug("Condition satisfied")
 		}
 
+		// deprecated, use wait conditions instead
 		if val, ok := res["waitTime"]; ok {
 			delete(res, "stop")
 			delete(res, "waitTime")
@@ -261,6 +503,8 @@ func parseURL(index int, info URLInfo, driver *agouti.WebDriver) error {
 		"url":   url,
 	}).Debug("Parse finished")
 
+	links := pageLinks(index, page, info)
+
 	if info.DumpHTML {
 		res["html"], err = page.HTML()
 		if err != nil {
@@ -268,7 +512,7 @@ func parseURL(index int, info URLInfo, driver *agouti.WebDriver) error {
 				"index": index,
 				"url":   url,
 			}).Warn("Failed to get html")
-			return err
+			return nil, nil, newParseError(ErrDriverCrash, err)
 		}
 	}
 
@@ -277,132 +521,150 @@ func parseURL(index int, info URLInfo, driver *agouti.WebDriver) error {
 			"index": index,
 			"url":   url,
 		}).Debug("Get empty response")
-		return nil
+		return nil, links, newParseError(ErrEmptyResult, fmt.Errorf("no result"))
 	}
 
-	info.ResChan <- URLRes{URL: url, Res: res}
+	// network capture is just for auditing, so failure is ignored
+	if info.Network != "" {
+		entries, err := captureNetwork(page, info.Network)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"index": index,
+				"url":   url,
+				"err":   err,
+			}).Warn("Failed to capture network")
+		} else if info.Network == "har" {
+			res["har"] = entries
+		} else {
+			res["network"] = entries
+		}
+	}
 
-	return nil
+	// screenshot is just for checking results, so failure is ignored
+	if info.Screenshot != "" {
+		path, err := takeScreenshot(page, url, info.Screenshot)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"index": index,
+				"url":   url,
+				"err":   err,
+			}).Warn("Failed to take screenshot")
+		} else {
+			res["screenshot"] = path
+		}
+	}
+
+	return res, links, nil
+}
+
+// pageLinks return links in page if they should be followed, errors are ignored
+func pageLinks(index int, page Page, info URLInfo) []string {
+	if info.Follow == nil || info.Depth >= info.Follow.MaxDepth {
+		return nil
+	}
+	links, err := info.Follow.Links(page)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"index": index,
+			"url":   info.URL,
+			"err":   err,
+		}).Warn("Failed to get links")
+	}
+	return links
 }
 
-func walkFile(infoChan chan<- URLInfo) func(path string, f os.FileInfo, err error) error {
-	info := new(URLInfo)
+func walkFile(run *crawlRun, sched *hostScheduler) func(path string, f os.FileInfo, err error) error {
 	return func(path string, f os.FileInfo, err error) error {
 		if f.IsDir() {
 			return nil
 		}
+		info := new(URLInfo)
 		log.WithFields(log.Fields{
 			"path":     path,
 			"fileName": f.Name(),
 		}).Debug("Get crawler data file")
 
-		// find script
+		// find conf, it has been parsed and checked when starting
 		filename := f.Name()
-		if !viper.IsSet(filename) {
+		conf, ok := crawlConfs[strings.ToLower(filename)]
+		if !ok || conf.Template {
 			log.WithFields(log.Fields{
 				"filename": filename,
 			}).Warn("No conf item for data file")
 			return nil
 		}
-		conf := viper.GetStringMap(filename)
 		log.WithFields(log.Fields{
 			"filename": filename,
 			"conf":     conf,
 		}).Debug("Read conf for data file")
-		if val, ok := conf["ignore"]; ok && val.(bool) {
+		if conf.Ignore {
 			log.WithFields(log.Fields{
 				"conf": conf,
 			}).Warn("Data file is ignored by conf")
 			return nil
 		}
-
-		// get 'dump' setting
-		if val, ok := conf["dump_html"]; ok && val.(bool) {
-			info.DumpHTML = val.(bool)
-			log.WithField("dumpHTML", info.DumpHTML).Debug("Read dump_html conf")
-		}
-
-		// we can have multi scripts for one page
-		if _, ok := conf["script_name"]; !ok {
+		if len(conf.Errs) > 0 {
 			log.WithFields(log.Fields{
-				"conf": conf,
-			}).Warn("Data file's conf has no 'script_name' item")
-			return nil
-		}
-		var scriptPath []string
-		switch scripts := conf["script_name"].(type) {
-		case string:
-			scriptPath = append(scriptPath, filepath.Join(fCrawlScriptDir, scripts))
-		case []interface{}:
-			for _, v := range scripts {
-				scriptPath = append(scriptPath, filepath.Join(fCrawlScriptDir, v.(string)))
-			}
-		default:
-			log.WithFields(log.Fields{
-				"script_name": scripts,
-			}).Warn("Conf[script_name] is not string or array of string")
+				"filename": filename,
+				"errs":     conf.Errs.Error(),
+			}).Warn("Data file is skipped by invalid conf")
 			return nil
 		}
 
-		// load scripts
-		for _, v := range scriptPath {
-			data, err := ioutil.ReadFile(v)
-			if err != nil {
+		info.DumpHTML = conf.DumpHTML
+		info.Screenshot = conf.Screenshot
+		if info.Screenshot != "" {
+			if err := os.MkdirAll(filepath.Join(fEliseOutputDir, screenshotDir), os.ModePerm); err != nil {
 				log.WithFields(log.Fields{
-					"script_path": v,
-					"err":         err,
-				}).Warn("Failed to read script")
+					"dir": screenshotDir,
+					"err": err,
+				}).Warn("Failed to create screenshot dir")
 				return nil
 			}
-			info.JsFuncs = append(info.JsFuncs, string(data))
 		}
+		info.Network = conf.Network
+		info.Follow = conf.Follow
+		// urls are not de-duplicated by default
+		canon := conf.Dedup
+		info.Seen = newSeenSet(canon)
+		info.Driver = conf.Driver
+		info.Proxy = conf.Proxy
+		info.Profile = conf.Profile
+		if info.Profile != nil && info.Profile.Timezone != "" && info.Driver != "chrome" {
+			log.WithFields(log.Fields{
+				"timezone": info.Profile.Timezone,
+				"driver":   info.Driver,
+			}).Warn("Conf[timezone] is only supported by chrome, ignored")
+		}
+		info.HostLimit = conf.HostLimit
+		info.Retry = conf.Retry
+		info.Timeouts = conf.Timeouts
 
-		ctx, cancel := context.WithCancel(context.Background())
-		// write output file routine
-		resChan := make(chan URLRes, fEliseParallel+fEliseParallel/2+1)
-		// TODO: make sure finish to write output file before exit
-		go func() {
-			// create output file
-			var resFilename string
-			if val, ok := conf["output_file"]; ok {
-				resFilename = val.(string)
-			} else {
-				resFilename = filename
-			}
-			noSuffix := strings.TrimSuffix(resFilename, filepath.Ext(resFilename))
-			resPath := filepath.Join(fEliseOutputDir, noSuffix+".txt")
-			resFile, err := os.Create(resPath)
-			if err != nil {
-				log.WithFields(log.Fields{
-					"res_path": resPath,
-					"err":      err,
-				}).Warn("Failed to create output file")
-				cancel()
-			}
+		// we can have multi scripts for one page, or just declare fields
+		loader := make(scriptLoader)
+		if info.JsFuncs, err = loader.Load(conf.ScriptNames); err != nil {
+			log.WithFields(log.Fields{
+				"script_name": conf.ScriptNames,
+				"err":         err,
+			}).Warn("Failed to read script")
+			return nil
+		}
+		// fields are extracted and background images are marked after scripts,
+		// so scripts can prepare the page
+		var confJS []string
+		if conf.FieldsJS != "" {
+			confJS = append(confJS, conf.FieldsJS)
+		}
+		if conf.BackgroundImages {
+			confJS = append(confJS, backgroundScript)
+		}
+		info.JsFuncs = append(info.JsFuncs, confJS...)
+		jsFuncs := info.JsFuncs
 
-			line := 0
-			index := 0
-			for res := range resChan {
-				data, _ := json.Marshal(res.Res)
-				resFile.WriteString(fmt.Sprintf("%s\t%s\n", res.URL, string(data)))
-				line++
-				if line >= fEliseSplitCnt {
-					resFile.Close()
-					line = 0
-					index++
-					resPath = filepath.Join(fEliseOutputDir, noSuffix+"_"+strconv.Itoa(index)+".txt")
-					resFile, err = os.Create(resPath)
-					if err != nil {
-						log.WithFields(log.Fields{
-							"res_path": resPath,
-							"err":      err,
-						}).Warn("Failed to create output file")
-						cancel()
-					}
-				}
-			}
-			resFile.Close()
-		}()
+		// data file is one url per line by default
+		seedFormat := conf.Input
+		formatName := conf.OutputFormat
+		format := sinkFormats[formatName]
 
 		// read url from data file
 		inFile, err := os.Open(path)
@@ -415,36 +677,191 @@ func walkFile(infoChan chan<- URLInfo) func(path string, f os.FileInfo, err erro
 		}
 		defer inFile.Close()
 
+		ckpt, err := openCheckpoint(checkpointPath(filename), fCrawlResume)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"checkpoint": checkpointPath(filename),
+				"err":        err,
+			}).Warn("Failed to open checkpoint")
+			return nil
+		}
+
+		resFilename := conf.OutputFile
+		if resFilename == "" {
+			resFilename = filename
+		}
+		noSuffix := strings.TrimSuffix(resFilename, filepath.Ext(resFilename))
+
+		// urls in output of previous run are skipped too when resume
+		if canon != nil && fCrawlResume {
+			err := format.ScanURLs(noSuffix, func(url string) {
+				info.Seen.Add(url)
+			})
+			if err != nil {
+				log.WithFields(log.Fields{
+					"output": noSuffix,
+					"err":    err,
+				}).Warn("Failed to read output of previous run")
+				ckpt.Close()
+				return nil
+			}
+		}
+
+		// opened before scanning, so a data file without output is skipped alone
+		sink, err := format.Open(noSuffix, fCrawlResume)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"output": noSuffix,
+				"format": formatName,
+				"err":    err,
+			}).Warn("Failed to open output")
+			ckpt.Close()
+			return nil
+		}
+
 		fi := FileInfo{
 			Filename: filename,
 			Start:    time.Now(),
 			Done:     new(sync.WaitGroup),
 		}
 		info.FInfo = &fi
+		if fi.Lines, err = countLines(path); err != nil {
+			log.WithFields(log.Fields{
+				"path": path,
+				"err":  err,
+			}).Warn("Failed to count lines of data file")
+		}
+		run.addFile(&fi)
+
+		ctx, cancel := context.WithCancel(run.ctx)
+		defer cancel()
+		// write output file routine
+		resChan := make(chan URLRes, fEliseParallel+fEliseParallel/2+1)
+		run.writers.Add(1)
+		go func() {
+			defer run.writers.Done()
+			defer ckpt.Close()
+
+			write := func(res URLRes) {
+				// result must be written before checkpoint
+				if err := sink.Write(res); err != nil {
+					log.WithFields(log.Fields{
+						"url": res.URL,
+						"err": err,
+					}).Warn("Failed to write result")
+					cancel()
+					return
+				}
+				if res.Err != nil {
+					// not checkpointed, so it will be retried when resume
+					atomic.AddUint64(&fi.Failed, 1)
+					if isTimeoutKind(errKindOf(res.Err)) {
+						atomic.AddUint64(&fi.TimedOut, 1)
+					}
+					return
+				}
+				// urls found by following links are not in data file
+				if res.Line > 0 {
+					ckpt.Mark(res.Line, res.URL)
+				}
+				if res.Res == nil {
+					atomic.AddUint64(&fi.Empty, 1)
+				}
+				atomic.AddUint64(&fi.Completed, 1)
+			}
+
+		WRITE:
+			for {
+				select {
+				case res, ok := <-resChan:
+					if !ok {
+						break WRITE
+					}
+					write(res)
+				case <-run.abort:
+					// save results already received, abandon the others
+					for {
+						select {
+						case res, ok := <-resChan:
+							if !ok {
+								break WRITE
+							}
+							write(res)
+						default:
+							break WRITE
+						}
+					}
+				}
+			}
+			sink.Close()
+			atomic.StoreInt64(&fi.End, time.Now().UnixNano())
+		}()
+
 		log.WithFields(log.Fields{
 			"filename": filename,
 			"start":    info.FInfo.Start,
 		}).Info("Start to crawler urls in one file")
 
 		sc := bufio.NewScanner(inFile)
+	SCAN:
 		for sc.Scan() {
-			select {
-			case <-ctx.Done():
+			info.Line = atomic.AddUint64(&info.FInfo.Line, 1)
+			if info.Line == 1 && seedFormat.NeedHeader() {
+				if err := seedFormat.SetHeader(sc.Text()); err != nil {
+					log.WithFields(log.Fields{
+						"filename": filename,
+						"err":      err,
+					}).Warn("Failed to read header of data file")
+					break SCAN
+				}
+				continue
+			}
+			if info.URL, info.Meta, err = seedFormat.Parse(sc.Text()); err != nil {
+				atomic.AddUint64(&info.FInfo.Invalid, 1)
 				log.WithFields(log.Fields{
 					"filename": filename,
-					"line":     atomic.LoadUint64(&info.FInfo.Line),
-					"elapsed":  time.Since(info.FInfo.Start),
-				}).Info("Partial finished to crawler urls in one file")
-
-				return ctx.Err()
-			default:
-				info.FInfo.Done.Add(1)
-				info.URL = sc.Text()
-				info.ResChan = resChan
-				atomic.AddUint64(&info.FInfo.Line, 1)
-				// log.WithField("info", info).Debug("Create one info")
-				infoChan <- *info
+					"line":     info.Line,
+					"err":      err,
+				}).Warn("Failed to parse seed")
+				continue
+			}
+			if ckpt.Done(info.Line, info.URL) {
+				atomic.AddUint64(&info.FInfo.Skipped, 1)
+				continue
+			}
+			// seeds are always recorded, so links to them won't be followed
+			if !info.Seen.Add(info.URL) && canon != nil {
+				atomic.AddUint64(&info.FInfo.Duplicated, 1)
+				log.WithField("url", info.URL).Debug("Skip duplicated url")
+				continue
+			}
+			// scripts of data file can be overridden by seed, scripts of conf are still run
+			info.JsFuncs = jsFuncs
+			if val, ok := info.Meta[metaScriptName]; ok {
+				scripts, err := loader.Load(cast.ToStringSlice(val))
+				if err != nil {
+					atomic.AddUint64(&info.FInfo.Invalid, 1)
+					log.WithFields(log.Fields{
+						"line":        info.Line,
+						"script_name": val,
+						"err":         err,
+					}).Warn("Failed to read script of seed")
+					continue
+				}
+				info.JsFuncs = append(scripts, confJS...)
+			}
+			info.ResChan = resChan
+			info.Attempt = 1
+			if info.Follow != nil {
+				info.SeedURL = info.URL
+				info.Seed = &followSeed{pages: 1}
 			}
+			info.FInfo.Done.Add(1)
+			if err := sched.Push(ctx, *info); err != nil {
+				info.FInfo.Done.Done()
+				break SCAN
+			}
+			atomic.AddUint64(&info.FInfo.Dispatched, 1)
 		}
 
 		go func() {
@@ -453,10 +870,21 @@ func walkFile(infoChan chan<- URLInfo) func(path string, f os.FileInfo, err erro
 			log.WithFields(log.Fields{
 				"filename": filename,
 				"line":     atomic.LoadUint64(&info.FInfo.Line),
+				"skipped":  atomic.LoadUint64(&info.FInfo.Skipped),
 				"elapsed":  time.Since(info.FInfo.Start),
 			}).Info("Finished to crawler urls in one file")
 		}()
 
+		if ctx.Err() != nil {
+			log.WithFields(log.Fields{
+				"filename": filename,
+				"line":     atomic.LoadUint64(&info.FInfo.Line),
+				"elapsed":  time.Since(info.FInfo.Start),
+			}).Info("Partial finished to crawler urls in one file")
+			// failed to write output of this file only, go on with other files
+			return run.ctx.Err()
+		}
+
 		return nil
 	}
 }
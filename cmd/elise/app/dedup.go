@@ -0,0 +1,144 @@
+package app
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cast"
+)
+
+// Canonicalizer build the key of url for de-duplication,
+// the url crawled is still the original one, since server may need the dropped params
+type Canonicalizer struct {
+	DropParams    []string // glob patterns of query params to drop, eg: sign, utm_*
+	LowercaseHost bool
+	SortQuery     bool
+	TrailingSlash bool // strip trailing slash of path
+}
+
+// parseCanonicalizer read 'dedup' conf of data file, 'dedup: true' enable the defaults
+//
+//	dedup:
+//	  drop_params: [sign, timestamp, utm_*]
+//	  lowercase_host: true
+//	  sort_query: true
+//	  trailing_slash: true
+func parseCanonicalizer(val interface{}) (*Canonicalizer, error) {
+	c := &Canonicalizer{LowercaseHost: true, SortQuery: true, TrailingSlash: true}
+	if on, ok := val.(bool); ok {
+		if !on {
+			return nil, nil
+		}
+		return c, nil
+	}
+	conf, err := cast.ToStringMapE(val)
+	if err != nil {
+		return nil, err
+	}
+	for key, v := range conf {
+		switch key {
+		case "drop_params":
+			c.DropParams, err = cast.ToStringSliceE(v)
+			for _, pattern := range c.DropParams {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return nil, fmt.Errorf("invalid pattern %q in drop_params", pattern)
+				}
+			}
+		case "lowercase_host":
+			c.LowercaseHost, err = cast.ToBoolE(v)
+		case "sort_query":
+			c.SortQuery, err = cast.ToBoolE(v)
+		case "trailing_slash":
+			c.TrailingSlash, err = cast.ToBoolE(v)
+		default:
+			return nil, fmt.Errorf("unknown dedup conf %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid dedup conf %q: %v", key, err)
+		}
+	}
+	return c, nil
+}
+
+// Canonical return url for comparing, fragment and default port are always dropped
+func (c *Canonicalizer) Canonical(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return rawURL
+	}
+	u.Fragment = ""
+	if port := u.Port(); port == "" || (port == "80" && u.Scheme == "http") || (port == "443" && u.Scheme == "https") {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+	if c == nil {
+		return u.String()
+	}
+	if c.LowercaseHost {
+		u.Scheme = strings.ToLower(u.Scheme)
+		u.Host = strings.ToLower(u.Host)
+	}
+	if c.TrailingSlash && len(u.Path) > 1 {
+		u.Path = strings.TrimRight(u.Path, "/")
+		u.RawPath = ""
+	}
+	if u.RawQuery == "" || (len(c.DropParams) == 0 && !c.SortQuery) {
+		return u.String()
+	}
+
+	var params []string
+	for _, param := range strings.Split(u.RawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		name := param
+		if i := strings.IndexByte(param, '='); i >= 0 {
+			name = param[:i]
+		}
+		if name, err := url.QueryUnescape(name); err == nil && c.drop(name) {
+			continue
+		}
+		params = append(params, param)
+	}
+	if c.SortQuery {
+		sort.Strings(params)
+	}
+	u.RawQuery = strings.Join(params, "&")
+	return u.String()
+}
+
+func (c *Canonicalizer) drop(name string) bool {
+	for _, pattern := range c.DropParams {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// seenSet record canonical urls queued or crawled for one data file
+type seenSet struct {
+	canon *Canonicalizer
+
+	mu   sync.Mutex
+	urls map[string]bool
+}
+
+func newSeenSet(canon *Canonicalizer) *seenSet {
+	return &seenSet{canon: canon, urls: make(map[string]bool)}
+}
+
+// Add return false if url has been seen
+func (s *seenSet) Add(rawURL string) bool {
+	key := s.canon.Canonical(rawURL)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.urls[key] {
+		return false
+	}
+	s.urls[key] = true
+	return true
+}
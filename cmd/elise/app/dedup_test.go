@@ -0,0 +1,106 @@
+package app
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCanonical(t *testing.T) {
+	defaults := &Canonicalizer{LowercaseHost: true, SortQuery: true, TrailingSlash: true}
+	tracking := &Canonicalizer{DropParams: []string{"utm_*", "fbclid", "spm"}, LowercaseHost: true, SortQuery: true}
+	keepAll := &Canonicalizer{}
+	tests := []struct {
+		canon *Canonicalizer
+		url   string
+		want  string
+	}{
+		// scheme and host case
+		{defaults, "HTTP://WWW.Example.COM/Path", "http://www.example.com/Path"},
+		{keepAll, "HTTPS://WWW.Example.COM/Path", "https://WWW.Example.COM/Path"},
+		// default ports
+		{defaults, "http://example.com:80/a", "http://example.com/a"},
+		{defaults, "https://example.com:443/a", "https://example.com/a"},
+		{defaults, "HTTPS://Example.com:443/a", "https://example.com/a"},
+		{defaults, "http://example.com:/a", "http://example.com/a"},
+		{defaults, "http://example.com:8080/a", "http://example.com:8080/a"},
+		{defaults, "https://example.com:80/a", "https://example.com:80/a"},
+		{defaults, "http://[::1]:80/a", "http://[::1]/a"},
+		{nil, "http://example.com:80/a", "http://example.com/a"},
+		// fragment
+		{defaults, "http://example.com/a#top", "http://example.com/a"},
+		{nil, "http://example.com/a?b=1#top", "http://example.com/a?b=1"},
+		{keepAll, "http://example.com/#/route", "http://example.com/"},
+		// trailing slash
+		{defaults, "http://example.com/a/", "http://example.com/a"},
+		{defaults, "http://example.com/", "http://example.com/"},
+		{keepAll, "http://example.com/a/", "http://example.com/a/"},
+		// query ordering
+		{defaults, "http://example.com/?b=2&a=1&a=0", "http://example.com/?a=0&a=1&b=2"},
+		{defaults, "http://example.com/?b=2&&a=1&", "http://example.com/?a=1&b=2"},
+		{keepAll, "http://example.com/?b=2&a=1", "http://example.com/?b=2&a=1"},
+		// tracking params
+		{tracking, "http://example.com/p?id=1&utm_source=x&utm_medium=y&fbclid=z", "http://example.com/p?id=1"},
+		{tracking, "http://example.com/p?utm_source=x", "http://example.com/p"},
+		{tracking, "http://example.com/p?spm=1&spmid=2", "http://example.com/p?spmid=2"},
+		{tracking, "http://example.com/p?utm%5Fsource=x&id=1", "http://example.com/p?id=1"},
+		{defaults, "http://example.com/p?utm_source=x", "http://example.com/p?utm_source=x"},
+		// spaces around url and invalid url
+		{defaults, "  http://example.com/a  ", "http://example.com/a"},
+		{defaults, "http://exa mple.com/%zz", "http://exa mple.com/%zz"},
+	}
+	for _, tt := range tests {
+		if got := tt.canon.Canonical(tt.url); got != tt.want {
+			t.Errorf("Canonical(%q) of %+v = %q, want %q", tt.url, tt.canon, got, tt.want)
+		}
+	}
+}
+
+func TestParseCanonicalizer(t *testing.T) {
+	tests := []struct {
+		conf interface{}
+		want *Canonicalizer
+		err  string
+	}{
+		{true, &Canonicalizer{LowercaseHost: true, SortQuery: true, TrailingSlash: true}, ""},
+		{false, nil, ""},
+		{
+			map[string]interface{}{"drop_params": []interface{}{"utm_*", "sign"}, "sort_query": false},
+			&Canonicalizer{DropParams: []string{"utm_*", "sign"}, LowercaseHost: true, TrailingSlash: true},
+			"",
+		},
+		{map[string]interface{}{"drop": []interface{}{"sign"}}, nil, `unknown dedup conf "drop"`},
+		{map[string]interface{}{"drop_params": []interface{}{"utm_["}}, nil, `invalid pattern "utm_["`},
+		{map[string]interface{}{"trailing_slash": "maybe"}, nil, `"trailing_slash"`},
+	}
+	for _, tt := range tests {
+		got, err := parseCanonicalizer(tt.conf)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parseCanonicalizer(%v) error = %v, want %q", tt.conf, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseCanonicalizer(%v) = %+v %v, want %+v", tt.conf, got, err, tt.want)
+		}
+	}
+}
+
+func TestSeenSet(t *testing.T) {
+	s := newSeenSet(&Canonicalizer{DropParams: []string{"utm_*"}, LowercaseHost: true, SortQuery: true, TrailingSlash: true})
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"http://example.com/a?x=1&y=2", true},
+		{"HTTP://EXAMPLE.COM:80/a/?y=2&x=1&utm_source=feed#c", false},
+		{"http://example.com/a?x=1", true},
+		{"https://example.com/a?x=1&y=2", true},
+	}
+	for _, tt := range tests {
+		if got := s.Add(tt.url); got != tt.want {
+			t.Errorf("Add(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Driver is a browser backend used by crawl workers
+type Driver interface {
+	Start() error
+	NewPage() (Page, error)
+	Stop() error
+}
+
+// Page is one browser session created by Driver
+type Page interface {
+	Navigate(url string) error
+	// RunScript run body as a function, keys of arguments become the function parameters
+	RunScript(body string, arguments map[string]interface{}, result interface{}) error
+	HTML() (string, error)
+	Destroy() error
+}
+
+// proxyDriver is implemented by drivers which can create pages using proxy
+type proxyDriver interface {
+	NewProxyPage(proxy *url.URL) (Page, error)
+}
+
+// newPage create page using proxy, nil proxy means direct
+func newPage(driver Driver, proxy *url.URL) (Page, error) {
+	if proxy == nil {
+		return driver.NewPage()
+	}
+	d, ok := driver.(proxyDriver)
+	if !ok {
+		return nil, fmt.Errorf("driver can't use proxy")
+	}
+	return d.NewProxyPage(proxy)
+}
+
+var driverCreators = map[string]func() Driver{
+	"phantomjs": newPhantomJSDriver,
+	"chrome":    newChromeDriver,
+	"http":      newHTTPDriver,
+}
+
+func driverNames() []string {
+	var names []string
+	for name := range driverCreators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newDriver(name string) (Driver, error) {
+	creator, ok := driverCreators[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown driver %q, should be one of %v", name, driverNames())
+	}
+	return creator(), nil
+}
+
+// startedDrivers track drivers started by all workers,
+// so they can be stopped while workers are blocked
+var startedDrivers = struct {
+	sync.Mutex
+	m map[Driver]bool
+}{m: make(map[Driver]bool)}
+
+func stopStartedDrivers() {
+	startedDrivers.Lock()
+	defer startedDrivers.Unlock()
+	for driver := range startedDrivers.m {
+		driver.Stop()
+		delete(startedDrivers.m, driver)
+	}
+}
+
+// workerDrivers hold drivers started by one worker, driver is started lazily
+type workerDrivers map[string]Driver
+
+func (wd workerDrivers) get(index int, name string) (Driver, error) {
+	if driver, ok := wd[name]; ok {
+		return driver, nil
+	}
+	driver, err := newDriver(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := driver.Start(); err != nil {
+		return nil, err
+	}
+	log.WithFields(log.Fields{
+		"index":  index,
+		"driver": name,
+	}).Debug("Success to start driver")
+	wd[name] = driver
+	startedDrivers.Lock()
+	startedDrivers.m[driver] = true
+	startedDrivers.Unlock()
+	return driver, nil
+}
+
+// stop driver, it will be restarted when used next time
+func (wd workerDrivers) stop(name string) {
+	if driver, ok := wd[name]; ok {
+		startedDrivers.Lock()
+		// maybe stopped while shutting down
+		if startedDrivers.m[driver] {
+			driver.Stop()
+			delete(startedDrivers.m, driver)
+		}
+		startedDrivers.Unlock()
+		delete(wd, name)
+	}
+}
+
+func (wd workerDrivers) stopAll() {
+	for name := range wd {
+		wd.stop(name)
+	}
+}
+
+// wrapScript build an expression which call body with arguments,
+// just like agouti does for webdriver
+func wrapScript(body string, arguments map[string]interface{}) (string, error) {
+	var keys []string
+	for key := range arguments {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var values []string
+	for _, key := range keys {
+		data, err := json.Marshal(arguments[key])
+		if err != nil {
+			return "", err
+		}
+		values = append(values, string(data))
+	}
+
+	return fmt.Sprintf("(function(%s) { %s; }).apply(this, [%s])",
+		strings.Join(keys, ", "), body, strings.Join(values, ", ")), nil
+}
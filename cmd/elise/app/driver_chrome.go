@@ -0,0 +1,272 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/target"
+	"github.com/chromedp/chromedp"
+)
+
+// chromeDriver drive headless chrome via Chrome DevTools Protocol
+type chromeDriver struct {
+	allocCtx      context.Context
+	allocCancel   context.CancelFunc
+	browserCtx    context.Context
+	browserCancel context.CancelFunc
+}
+
+func newChromeDriver() Driver {
+	return &chromeDriver{}
+}
+
+func (d *chromeDriver) Start() error {
+	d.allocCtx, d.allocCancel = chromedp.NewExecAllocator(context.Background(),
+		chromedp.DefaultExecAllocatorOptions[:]...)
+	d.browserCtx, d.browserCancel = chromedp.NewContext(d.allocCtx)
+	// the first Run launch the browser
+	if err := chromedp.Run(d.browserCtx); err != nil {
+		d.Stop()
+		return err
+	}
+	return nil
+}
+
+func (d *chromeDriver) NewPage() (Page, error) {
+	return d.newPage()
+}
+
+// NewProxyPage create tab in a new browser context using proxy,
+// credentials of proxy are not supported by chrome
+func (d *chromeDriver) NewProxyPage(proxy *url.URL) (Page, error) {
+	if proxy.User != nil {
+		return nil, fmt.Errorf("chrome can't use proxy with credentials")
+	}
+	server := proxy.Scheme + "://" + proxy.Host
+	return d.newPage(chromedp.WithNewBrowserContext(
+		func(p *target.CreateBrowserContextParams) *target.CreateBrowserContextParams {
+			return p.WithProxyServer(server)
+		}))
+}
+
+func (d *chromeDriver) newPage(opts ...chromedp.ContextOption) (Page, error) {
+	ctx, cancel := chromedp.NewContext(d.browserCtx, opts...)
+	if err := chromedp.Run(ctx); err != nil {
+		cancel()
+		return nil, err
+	}
+	p := &chromePage{
+		ctx:           ctx,
+		cancel:        cancel,
+		pageLoad:      300 * time.Second,
+		scriptTimeout: 30 * time.Second,
+		inflight:      make(map[network.RequestID]bool),
+		current:       make(map[network.RequestID]int),
+		lastActive:    time.Now(),
+	}
+	chromedp.ListenTarget(ctx, p.trackNetwork)
+	return p, nil
+}
+
+func (d *chromeDriver) Stop() error {
+	if d.browserCancel != nil {
+		d.browserCancel()
+	}
+	if d.allocCancel != nil {
+		d.allocCancel()
+	}
+	return nil
+}
+
+// chromePage is one tab of chrome
+type chromePage struct {
+	ctx           context.Context
+	cancel        context.CancelFunc
+	pageLoad      time.Duration
+	scriptTimeout time.Duration
+
+	mu         sync.Mutex
+	inflight   map[network.RequestID]bool
+	lastActive time.Time
+	entries    []NetworkEntry
+	current    map[network.RequestID]int // index of the latest entry of request
+}
+
+// trackNetwork record running requests, redirects share the same request id
+func (p *chromePage) trackNetwork(ev interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch ev := ev.(type) {
+	case *network.EventRequestWillBeSent:
+		p.inflight[ev.RequestID] = true
+		if idx, ok := p.current[ev.RequestID]; ok && ev.RedirectResponse != nil {
+			e := &p.entries[idx]
+			e.Status = int(ev.RedirectResponse.Status)
+			e.ContentType = ev.RedirectResponse.MimeType
+			e.Size = int64(ev.RedirectResponse.EncodedDataLength)
+			e.RedirectURL = ev.Request.URL
+			e.Time = millisecondsSince(e.Start)
+		}
+		p.current[ev.RequestID] = len(p.entries)
+		p.entries = append(p.entries, NetworkEntry{
+			URL:    ev.Request.URL,
+			Method: ev.Request.Method,
+			Size:   -1,
+			Start:  time.Now(),
+		})
+	case *network.EventResponseReceived:
+		if idx, ok := p.current[ev.RequestID]; ok {
+			p.entries[idx].Status = int(ev.Response.Status)
+			p.entries[idx].ContentType = ev.Response.MimeType
+		}
+	case *network.EventLoadingFinished:
+		delete(p.inflight, ev.RequestID)
+		if idx, ok := p.current[ev.RequestID]; ok {
+			p.entries[idx].Size = int64(ev.EncodedDataLength)
+			p.entries[idx].Time = millisecondsSince(p.entries[idx].Start)
+		}
+	case *network.EventLoadingFailed:
+		delete(p.inflight, ev.RequestID)
+		if idx, ok := p.current[ev.RequestID]; ok {
+			p.entries[idx].Error = ev.ErrorText
+			p.entries[idx].Time = millisecondsSince(p.entries[idx].Start)
+		}
+	default:
+		return
+	}
+	p.lastActive = time.Now()
+}
+
+// NetworkEntries return requests recorded since page created
+func (p *chromePage) NetworkEntries() ([]NetworkEntry, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]NetworkEntry(nil), p.entries...), nil
+}
+
+// WaitNetworkIdle wait until there is no running request for idle
+func (p *chromePage) WaitNetworkIdle(idle, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		p.mu.Lock()
+		running := len(p.inflight)
+		quiet := time.Since(p.lastActive)
+		p.mu.Unlock()
+		if running == 0 && quiet >= idle {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return newParseError(ErrWaitTimeout,
+				fmt.Errorf("waitForNetworkIdle: %d requests still running after %v", running, timeout))
+		}
+		select {
+		case <-time.After(waitPollInterval):
+		case <-p.ctx.Done():
+			return p.ctx.Err()
+		}
+	}
+}
+
+func (p *chromePage) SetTimeouts(pageLoad, script time.Duration) error {
+	if pageLoad > 0 {
+		p.pageLoad = pageLoad
+	}
+	if script > 0 {
+		p.scriptTimeout = script
+	}
+	return nil
+}
+
+// Emulate override device of the tab, cookies are set for target url
+func (p *chromePage) Emulate(profile *Profile, url string) error {
+	tasks := chromedp.Tasks{network.Enable()}
+	if profile.UserAgent != "" {
+		tasks = append(tasks, emulation.SetUserAgentOverride(profile.UserAgent).
+			WithAcceptLanguage(profile.AcceptLanguage()))
+	}
+	if v := profile.Viewport; v.Width > 0 {
+		scale := v.Scale
+		if scale <= 0 {
+			scale = 1
+		}
+		tasks = append(tasks,
+			emulation.SetDeviceMetricsOverride(int64(v.Width), int64(v.Height), scale, v.Mobile),
+			emulation.SetTouchEmulationEnabled(v.Mobile))
+	}
+	if headers := profile.RequestHeaders(); len(headers) > 0 {
+		h := make(network.Headers)
+		for k, v := range headers {
+			h[k] = v
+		}
+		tasks = append(tasks, network.SetExtraHTTPHeaders(h))
+	}
+	for _, c := range profile.CookiesFor(url) {
+		tasks = append(tasks, network.SetCookie(c.Name, c.Value).WithDomain(c.Domain).WithPath(c.Path))
+	}
+	if profile.Locale != "" {
+		tasks = append(tasks, emulation.SetLocaleOverride().WithLocale(profile.Locale))
+	}
+	if profile.Timezone != "" {
+		tasks = append(tasks, emulation.SetTimezoneOverride(profile.Timezone))
+	}
+
+	ctx, cancel := context.WithTimeout(p.ctx, p.scriptTimeout)
+	defer cancel()
+	return chromedp.Run(ctx, tasks)
+}
+
+func (p *chromePage) Navigate(url string) error {
+	ctx, cancel := context.WithTimeout(p.ctx, p.pageLoad)
+	defer cancel()
+	return chromedp.Run(ctx, chromedp.Navigate(url))
+}
+
+func (p *chromePage) RunScript(body string, arguments map[string]interface{}, result interface{}) error {
+	expr, err := wrapScript(body, arguments)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(p.ctx, p.scriptTimeout)
+	defer cancel()
+	return chromedp.Run(ctx, chromedp.Evaluate(expr, result))
+}
+
+func (p *chromePage) HTML() (string, error) {
+	var html string
+	ctx, cancel := context.WithTimeout(p.ctx, p.scriptTimeout)
+	defer cancel()
+	err := chromedp.Run(ctx, chromedp.Evaluate("document.documentElement.outerHTML", &html))
+	return html, err
+}
+
+// Screenshot save png of the viewport
+func (p *chromePage) Screenshot(filename string) error {
+	var buf []byte
+	return p.screenshot(filename, chromedp.CaptureScreenshot(&buf), &buf)
+}
+
+// FullScreenshot save png of the whole page, quality 100 means png
+func (p *chromePage) FullScreenshot(filename string) error {
+	var buf []byte
+	return p.screenshot(filename, chromedp.FullScreenshot(&buf, 100), &buf)
+}
+
+func (p *chromePage) screenshot(filename string, action chromedp.Action, buf *[]byte) error {
+	ctx, cancel := context.WithTimeout(p.ctx, p.scriptTimeout)
+	defer cancel()
+	if err := chromedp.Run(ctx, action); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, *buf, 0666)
+}
+
+func (p *chromePage) Destroy() error {
+	p.cancel()
+	return nil
+}
@@ -0,0 +1,724 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	log "github.com/Sirupsen/logrus"
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+	"github.com/dop251/goja"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/net/publicsuffix"
+)
+
+// httpDriver fetch page by net/http without browser, and run scripts
+// in an embedded javascript engine with a minimal DOM shim.
+// It's enough for scripts only querying the static DOM.
+type httpDriver struct {
+	client *http.Client
+	ctx    context.Context // canceled by Stop to abort requests in flight
+	cancel context.CancelFunc
+
+	mu      sync.Mutex              // Stop may be called by other goroutine when shutting down
+	proxied map[string]*http.Client // proxy => client, so connections are reused
+}
+
+func newHTTPDriver() Driver {
+	return &httpDriver{}
+}
+
+func (d *httpDriver) Start() error {
+	d.client = &http.Client{}
+	d.mu.Lock()
+	d.proxied = make(map[string]*http.Client)
+	d.mu.Unlock()
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	return nil
+}
+
+func (d *httpDriver) NewPage() (Page, error) {
+	return d.newPage(d.client), nil
+}
+
+// NewProxyPage create page fetching by http or socks5 proxy
+func (d *httpDriver) NewProxyPage(proxy *url.URL) (Page, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	client, ok := d.proxied[proxy.String()]
+	if !ok {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = http.ProxyURL(proxy)
+		client = &http.Client{Transport: transport}
+		d.proxied[proxy.String()] = client
+	}
+	return d.newPage(client), nil
+}
+
+func (d *httpDriver) newPage(client *http.Client) Page {
+	return &httpPage{
+		ctx:           d.ctx,
+		client:        client,
+		pageLoad:      300 * time.Second,
+		scriptTimeout: 30 * time.Second,
+	}
+}
+
+func (d *httpDriver) Stop() error {
+	if d.cancel != nil {
+		d.cancel()
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, client := range d.proxied {
+		client.CloseIdleConnections()
+	}
+	return nil
+}
+
+type httpPage struct {
+	ctx           context.Context
+	client        *http.Client
+	pageLoad      time.Duration // fetching and parsing body included
+	scriptTimeout time.Duration
+	profile       *Profile
+
+	url     *url.URL
+	doc     *goquery.Document
+	vm      *goja.Runtime
+	nodes   map[*goja.Object]*html.Node // js object => DOM node
+	objs    map[*html.Node]*goja.Object // DOM node => js object, one object per node
+	entries []NetworkEntry              // redirect chain and the page itself
+}
+
+func (p *httpPage) Navigate(rawURL string) error {
+	// record every hop of redirect chain
+	client := *p.client
+	start := time.Now()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		resp := req.Response
+		p.entries = append(p.entries, NetworkEntry{
+			URL:         via[len(via)-1].URL.String(),
+			Method:      via[len(via)-1].Method,
+			Status:      resp.StatusCode,
+			ContentType: resp.Header.Get("Content-Type"),
+			Size:        resp.ContentLength,
+			RedirectURL: req.URL.String(),
+			Start:       start,
+			Time:        millisecondsSince(start),
+		})
+		start = time.Now()
+		if len(via) >= 10 {
+			return fmt.Errorf("stopped after 10 redirects")
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(p.ctx, p.pageLoad)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	if p.profile != nil {
+		for k, v := range p.profile.RequestHeaders() {
+			req.Header.Set(k, v)
+		}
+		if p.profile.UserAgent != "" {
+			req.Header.Set("User-Agent", p.profile.UserAgent)
+		}
+		if cookies := p.profile.CookiesFor(rawURL); len(cookies) > 0 {
+			jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+			if err != nil {
+				return err
+			}
+			jar.SetCookies(req.URL, cookies)
+			client.Jar = jar
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	entry := NetworkEntry{
+		URL:         resp.Request.URL.String(),
+		Method:      resp.Request.Method,
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Start:       start,
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		entry.Size = resp.ContentLength
+		entry.Time = millisecondsSince(start)
+		p.entries = append(p.entries, entry)
+		return fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+
+	body := &countReader{r: resp.Body}
+	r, err := charset.NewReader(body, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return err
+	}
+	doc, err := goquery.NewDocumentFromReader(r)
+	entry.Size = body.n
+	entry.Time = millisecondsSince(start)
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	p.entries = append(p.entries, entry)
+	if err != nil {
+		return err
+	}
+
+	// redirects have been followed
+	p.url = resp.Request.URL
+	p.doc = doc
+	p.initRuntime()
+	return nil
+}
+
+func (p *httpPage) SetTimeouts(pageLoad, script time.Duration) error {
+	if pageLoad > 0 {
+		p.pageLoad = pageLoad
+	}
+	if script > 0 {
+		p.scriptTimeout = script
+	}
+	return nil
+}
+
+// Emulate just keep profile, it's applied to request and js runtime by Navigate,
+// timezone is not supported
+func (p *httpPage) Emulate(profile *Profile, url string) error {
+	p.profile = profile
+	return nil
+}
+
+func (p *httpPage) RunScript(body string, arguments map[string]interface{}, result interface{}) error {
+	if p.vm == nil {
+		return fmt.Errorf("no page loaded")
+	}
+	expr, err := wrapScript(body, arguments)
+	if err != nil {
+		return err
+	}
+
+	timer := time.AfterFunc(p.scriptTimeout, func() {
+		p.vm.Interrupt("script timeout")
+	})
+	val, err := p.vm.RunString(expr)
+	// stop timer first, or it may interrupt the next script after cleared
+	timer.Stop()
+	p.vm.ClearInterrupt()
+	if err != nil {
+		return err
+	}
+
+	// same as webdriver, result is passed by json
+	data, err := json.Marshal(val.Export())
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, result)
+}
+
+// WaitNetworkIdle return at once, all content has been fetched by Navigate
+func (p *httpPage) WaitNetworkIdle(idle, timeout time.Duration) error {
+	return nil
+}
+
+// NetworkEntries return the redirect chain, resources are never fetched
+func (p *httpPage) NetworkEntries() ([]NetworkEntry, error) {
+	return p.entries, nil
+}
+
+func (p *httpPage) HTML() (string, error) {
+	if p.doc == nil {
+		return "", fmt.Errorf("no page loaded")
+	}
+	return p.doc.Html()
+}
+
+func (p *httpPage) Destroy() error {
+	p.vm = nil
+	p.doc = nil
+	p.nodes = nil
+	p.objs = nil
+	return nil
+}
+
+func (p *httpPage) initRuntime() {
+	vm := goja.New()
+	p.vm = vm
+	p.nodes = make(map[*goja.Object]*html.Node)
+	p.objs = make(map[*html.Node]*goja.Object)
+
+	location := vm.NewObject()
+	location.Set("href", p.url.String())
+	location.Set("protocol", p.url.Scheme+":")
+	location.Set("host", p.url.Host)
+	location.Set("hostname", p.url.Hostname())
+	location.Set("pathname", p.url.EscapedPath())
+	location.Set("search", "")
+	if p.url.RawQuery != "" {
+		location.Set("search", "?"+p.url.RawQuery)
+	}
+	location.Set("hash", "")
+	if p.url.Fragment != "" {
+		location.Set("hash", "#"+p.url.Fragment)
+	}
+	location.Set("toString", func() string { return p.url.String() })
+
+	document := p.element(p.doc.Nodes[0])
+	document.Set("nodeName", "#document")
+	document.Set("readyState", "complete")
+	document.Set("location", location)
+	p.accessor(document, "title", func() interface{} {
+		return strings.TrimSpace(p.doc.Find("title").First().Text())
+	})
+	p.accessor(document, "documentElement", func() interface{} {
+		return p.first(p.doc.Nodes[0], "html")
+	})
+	p.accessor(document, "head", func() interface{} {
+		return p.first(p.doc.Nodes[0], "head")
+	})
+	p.accessor(document, "body", func() interface{} {
+		return p.first(p.doc.Nodes[0], "body")
+	})
+	document.Set("getElementById", func(id string) interface{} {
+		return p.first(p.doc.Nodes[0], "#"+id)
+	})
+	document.Set("createElement", func(tag string) interface{} {
+		return p.element(&html.Node{Type: html.ElementNode, Data: strings.ToLower(tag)})
+	})
+	document.Set("evaluate", p.evaluate)
+
+	console := vm.NewObject()
+	console.Set("log", func(call goja.FunctionCall) goja.Value {
+		log.WithFields(log.Fields{
+			"url":  p.url.String(),
+			"args": call.Arguments,
+		}).Debug("Script console log")
+		return goja.Undefined()
+	})
+
+	// no layout here, viewport is the desktop one if not emulated
+	profile := Profile{UserAgent: "Go-http-client/1.1", Locale: "en-US", Viewport: devicePresets["desktop"].Viewport}
+	if p.profile != nil {
+		if p.profile.UserAgent != "" {
+			profile.UserAgent = p.profile.UserAgent
+		}
+		if p.profile.Locale != "" {
+			profile.Locale = p.profile.Locale
+		}
+		if p.profile.Viewport.Width > 0 {
+			profile.Viewport = p.profile.Viewport
+		}
+	}
+	navigator := vm.NewObject()
+	navigator.Set("userAgent", profile.UserAgent)
+	navigator.Set("language", profile.Locale)
+	navigator.Set("languages", []string{profile.Locale})
+	screen := vm.NewObject()
+	screen.Set("width", profile.Viewport.Width)
+	screen.Set("height", profile.Viewport.Height)
+
+	window := vm.GlobalObject()
+	window.Set("window", window)
+	window.Set("document", document)
+	window.Set("location", location)
+	window.Set("console", console)
+	window.Set("navigator", navigator)
+	window.Set("screen", screen)
+	window.Set("innerWidth", profile.Viewport.Width)
+	window.Set("innerHeight", profile.Viewport.Height)
+	window.Set("devicePixelRatio", 1.0)
+	if profile.Viewport.Scale > 0 {
+		window.Set("devicePixelRatio", profile.Viewport.Scale)
+	}
+	window.Set("getComputedStyle", func(obj *goja.Object) interface{} {
+		n, ok := p.nodes[obj]
+		if !ok {
+			panic(vm.NewTypeError("getComputedStyle: parameter is not an element"))
+		}
+		// no layout here, so only inline style is supported
+		return vm.NewDynamicObject(newStyleDecl(vm, n))
+	})
+}
+
+// element wrap DOM node as js object, the same node is always the same object
+func (p *httpPage) element(n *html.Node) *goja.Object {
+	if o, ok := p.objs[n]; ok {
+		return o
+	}
+	vm := p.vm
+	o := vm.NewObject()
+	p.nodes[o] = n
+	p.objs[n] = o
+
+	o.Set("nodeType", nodeType(n))
+	o.Set("nodeName", strings.ToUpper(n.Data))
+	o.Set("tagName", strings.ToUpper(n.Data))
+	o.Set("getAttribute", func(name string) interface{} {
+		if val, ok := getAttr(n, name); ok {
+			return val
+		}
+		return nil
+	})
+	o.Set("hasAttribute", func(name string) bool {
+		_, ok := getAttr(n, name)
+		return ok
+	})
+	o.Set("setAttribute", func(name string, val goja.Value) {
+		setAttr(n, name, val.String())
+	})
+	o.Set("removeAttribute", func(name string) {
+		for i, attr := range n.Attr {
+			if attr.Key == name {
+				n.Attr = append(n.Attr[:i], n.Attr[i+1:]...)
+				return
+			}
+		}
+	})
+	o.Set("querySelectorAll", func(selector string) []interface{} {
+		return p.all(n, selector)
+	})
+	o.Set("querySelector", func(selector string) interface{} {
+		return p.first(n, selector)
+	})
+	o.Set("getElementsByTagName", func(tag string) []interface{} {
+		return p.all(n, tag)
+	})
+	o.Set("getElementsByClassName", func(class string) []interface{} {
+		return p.all(n, "."+strings.Join(strings.Fields(class), "."))
+	})
+	o.Set("appendChild", func(child *goja.Object) *goja.Object {
+		c, ok := p.nodes[child]
+		if !ok {
+			panic(vm.NewTypeError("appendChild: parameter is not a node"))
+		}
+		if c.Parent != nil {
+			c.Parent.RemoveChild(c)
+		}
+		n.AppendChild(c)
+		return child
+	})
+	// there is no layout, all boxes are empty
+	o.Set("getBoundingClientRect", func() map[string]float64 {
+		return map[string]float64{
+			"top": 0, "left": 0, "right": 0, "bottom": 0, "width": 0, "height": 0,
+		}
+	})
+
+	p.accessor(o, "textContent", func() interface{} {
+		return goquery.NewDocumentFromNode(n).Text()
+	})
+	p.accessor(o, "innerText", func() interface{} {
+		return strings.TrimSpace(goquery.NewDocumentFromNode(n).Text())
+	})
+	p.accessor(o, "innerHTML", func() interface{} {
+		str, _ := goquery.NewDocumentFromNode(n).Html()
+		return str
+	})
+	p.accessor(o, "outerHTML", func() interface{} {
+		str, _ := goquery.OuterHtml(goquery.NewDocumentFromNode(n).Selection)
+		return str
+	})
+	p.accessor(o, "parentNode", func() interface{} {
+		if n.Parent == nil {
+			return nil
+		}
+		return p.element(n.Parent)
+	})
+	p.accessor(o, "children", func() interface{} {
+		var children []interface{}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode {
+				children = append(children, p.element(c))
+			}
+		}
+		return children
+	})
+	p.accessor(o, "style", func() interface{} {
+		return vm.NewDynamicObject(newStyleDecl(vm, n))
+	})
+	for _, name := range []string{"id", "className"} {
+		attrName := name
+		if name == "className" {
+			attrName = "class"
+		}
+		p.accessor(o, name, func() interface{} {
+			val, _ := getAttr(n, attrName)
+			return val
+		})
+	}
+	// browser resolve these to absolute url
+	for _, name := range []string{"src", "href"} {
+		attrName := name
+		p.accessor(o, name, func() interface{} {
+			val, ok := getAttr(n, attrName)
+			if !ok {
+				return ""
+			}
+			ref, err := url.Parse(strings.TrimSpace(val))
+			if err != nil {
+				return val
+			}
+			return p.url.ResolveReference(ref).String()
+		})
+	}
+	// natural size can't be known without downloading image, fallback to attributes
+	for name, attrName := range map[string]string{"naturalWidth": "width", "naturalHeight": "height"} {
+		attrName := attrName
+		p.accessor(o, name, func() interface{} {
+			val, _ := getAttr(n, attrName)
+			size, _ := strconv.Atoi(val)
+			return size
+		})
+	}
+
+	return o
+}
+
+// evaluate implement document.evaluate, result always support snapshot and single node,
+// attribute and text nodes are plain objects with nodeValue and textContent
+func (p *httpPage) evaluate(expr string, contextNode goja.Value) *goja.Object {
+	vm := p.vm
+	exp, err := xpath.Compile(expr)
+	if err != nil {
+		panic(vm.NewTypeError("evaluate: %v", err))
+	}
+	root := p.doc.Nodes[0]
+	if obj, ok := contextNode.(*goja.Object); ok {
+		if n, ok := p.nodes[obj]; ok {
+			root = n
+		}
+	}
+
+	res := vm.NewObject()
+	items := []interface{}{}
+	switch val := exp.Evaluate(htmlquery.CreateXPathNavigator(root)).(type) {
+	case *xpath.NodeIterator:
+		for val.MoveNext() {
+			nav := val.Current().(*htmlquery.NodeNavigator)
+			switch nav.NodeType() {
+			case xpath.AttributeNode:
+				items = append(items, p.valueNode(2, nav.LocalName(), nav.Value()))
+			case xpath.TextNode:
+				items = append(items, p.valueNode(3, "#text", nav.Value()))
+			default:
+				items = append(items, p.element(nav.Current()))
+			}
+		}
+	case string:
+		res.Set("stringValue", val)
+	case float64:
+		res.Set("numberValue", val)
+	case bool:
+		res.Set("booleanValue", val)
+	}
+	res.Set("snapshotLength", len(items))
+	res.Set("snapshotItem", func(i int) interface{} {
+		if i < 0 || i >= len(items) {
+			return nil
+		}
+		return items[i]
+	})
+	if len(items) > 0 {
+		res.Set("singleNodeValue", items[0])
+	} else {
+		res.Set("singleNodeValue", nil)
+	}
+	return res
+}
+
+func (p *httpPage) valueNode(typ int, name, val string) *goja.Object {
+	o := p.vm.NewObject()
+	o.Set("nodeType", typ)
+	o.Set("nodeName", name)
+	o.Set("nodeValue", val)
+	o.Set("value", val)
+	o.Set("textContent", val)
+	return o
+}
+
+func nodeType(n *html.Node) int {
+	switch n.Type {
+	case html.TextNode:
+		return 3
+	case html.CommentNode:
+		return 8
+	case html.DocumentNode:
+		return 9
+	}
+	return 1
+}
+
+func (p *httpPage) accessor(o *goja.Object, name string, getter func() interface{}) {
+	o.DefineAccessorProperty(name, p.vm.ToValue(getter), nil, goja.FLAG_FALSE, goja.FLAG_TRUE)
+}
+
+func (p *httpPage) all(n *html.Node, selector string) []interface{} {
+	elems := []interface{}{}
+	for _, node := range goquery.NewDocumentFromNode(n).Find(selector).Nodes {
+		elems = append(elems, p.element(node))
+	}
+	return elems
+}
+
+func (p *httpPage) first(n *html.Node, selector string) interface{} {
+	sel := goquery.NewDocumentFromNode(n).Find(selector)
+	if len(sel.Nodes) == 0 {
+		return nil
+	}
+	return p.element(sel.Nodes[0])
+}
+
+func getAttr(n *html.Node, name string) (string, bool) {
+	for _, attr := range n.Attr {
+		if attr.Key == name {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+func setAttr(n *html.Node, name, val string) {
+	for i, attr := range n.Attr {
+		if attr.Key == name {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: name, Val: val})
+}
+
+// styleDecl expose inline style of node as CSSStyleDeclaration,
+// unknown property is empty string just like browser
+type styleDecl struct {
+	vm *goja.Runtime
+	n  *html.Node
+}
+
+func newStyleDecl(vm *goja.Runtime, n *html.Node) *styleDecl {
+	return &styleDecl{vm: vm, n: n}
+}
+
+func (s *styleDecl) Get(key string) goja.Value {
+	if key == "getPropertyValue" {
+		return s.vm.ToValue(func(name string) string {
+			return parseStyle(s.n)[strings.ToLower(name)]
+		})
+	}
+	return s.vm.ToValue(parseStyle(s.n)[cssPropName(key)])
+}
+
+func (s *styleDecl) Set(key string, val goja.Value) bool {
+	props := parseStyle(s.n)
+	props[cssPropName(key)] = val.String()
+	var decls []string
+	for _, name := range sortedKeys(props) {
+		decls = append(decls, name+": "+props[name])
+	}
+	setAttr(s.n, "style", strings.Join(decls, "; "))
+	return true
+}
+
+func (s *styleDecl) Has(key string) bool {
+	return true
+}
+
+func (s *styleDecl) Delete(key string) bool {
+	return true
+}
+
+func (s *styleDecl) Keys() []string {
+	return sortedKeys(parseStyle(s.n))
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// parseStyle parse inline style into property map, keys are in css form
+func parseStyle(n *html.Node) map[string]string {
+	props := make(map[string]string)
+	style, _ := getAttr(n, "style")
+	for _, decl := range splitDecls(style) {
+		kv := strings.SplitN(decl, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		props[strings.ToLower(strings.TrimSpace(kv[0]))] = strings.TrimSpace(kv[1])
+	}
+	return props
+}
+
+// splitDecls split style by ';' which is not in parentheses or quotes, eg: url(data:image/png;base64,...)
+func splitDecls(style string) []string {
+	var decls []string
+	var depth int
+	var quote rune
+	start := 0
+	for i, r := range style {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case r == ';' && depth == 0:
+			decls = append(decls, style[start:i])
+			start = i + 1
+		}
+	}
+	return append(decls, style[start:])
+}
+
+// cssPropName convert 'backgroundImage' to 'background-image'
+func cssPropName(key string) string {
+	var buf strings.Builder
+	for _, r := range key {
+		if 'A' <= r && r <= 'Z' {
+			buf.WriteByte('-')
+			r += 'a' - 'A'
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,152 @@
+package app
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// loadPage navigate a http page to the html
+func loadPage(t *testing.T, body string) *httpPage {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+
+	d := newHTTPDriver()
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Stop() })
+	page, err := d.NewPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { page.Destroy() })
+	if err := page.Navigate(srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	return page.(*httpPage)
+}
+
+func TestHTTPPageScriptTimeout(t *testing.T) {
+	p := loadPage(t, "<html><body></body></html>")
+	p.scriptTimeout = 50 * time.Millisecond
+	var res int
+	if err := p.RunScript("while (true) {}", nil, &res); err == nil {
+		t.Fatal("endless script returned no error, want script timeout")
+	}
+	// interrupt of the timed out script doesn't leak to the next ones
+	for i := 0; i < 3; i++ {
+		if err := p.RunScript("return n + 1", map[string]interface{}{"n": i}, &res); err != nil || res != i+1 {
+			t.Fatalf("script after timeout = %d %v, want %d", res, err, i+1)
+		}
+	}
+}
+
+func TestHTTPPageElementIdentity(t *testing.T) {
+	p := loadPage(t, `<html><body><div id="box"><p id="a">a</p><p id="b">b</p></div></body></html>`)
+	script := `
+		var a = document.querySelector('#a'), b = document.getElementById('b');
+		return [
+			a === document.querySelector('#a'),
+			a.parentNode === b.parentNode,
+			a.parentNode === document.getElementById('box'),
+			document.getElementsByTagName('p')[1] === b,
+			a.parentNode.parentNode === document.querySelector('body'),
+		];`
+	var res []bool
+	if err := p.RunScript(script, nil, &res); err != nil {
+		t.Fatal(err)
+	}
+	for i, same := range res {
+		if !same {
+			t.Errorf("comparison %d of the same node = false, want true", i)
+		}
+	}
+	// wrapping nodes again doesn't grow the map
+	nodes := len(p.nodes)
+	if err := p.RunScript(script, nil, &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.nodes) != nodes {
+		t.Errorf("wrapped nodes = %d after running again, want %d", len(p.nodes), nodes)
+	}
+}
+
+func TestSplitDecls(t *testing.T) {
+	tests := []struct {
+		style string
+		want  []string
+	}{
+		{"", []string{""}},
+		{"width: 10px", []string{"width: 10px"}},
+		{"width: 10px;", []string{"width: 10px", ""}},
+		{"width: 10px; height: 20px;", []string{"width: 10px", " height: 20px", ""}},
+		{
+			"background: url(data:image/png;base64,iVBORw0KGgo=); width: 10px",
+			[]string{"background: url(data:image/png;base64,iVBORw0KGgo=)", " width: 10px"},
+		},
+		{
+			"background-image: url('a;b.png');color: red",
+			[]string{"background-image: url('a;b.png')", "color: red"},
+		},
+		{
+			`background-image: url("a;b.png")`,
+			[]string{`background-image: url("a;b.png")`},
+		},
+		{
+			// quotes in parentheses, and parentheses in quotes
+			`content: "a)b;c"; background: url('x(1);y.png')`,
+			[]string{`content: "a)b;c"`, ` background: url('x(1);y.png')`},
+		},
+		{
+			"background: url(a.png), url(data:image/gif;base64,R0lGOD;lhAQ=);top: 0",
+			[]string{"background: url(a.png), url(data:image/gif;base64,R0lGOD;lhAQ=)", "top: 0"},
+		},
+		{
+			// unbalanced parenthesis doesn't go negative
+			"width: 10px); height: 20px",
+			[]string{"width: 10px)", " height: 20px"},
+		},
+	}
+	for _, tt := range tests {
+		if got := splitDecls(tt.style); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitDecls(%q) = %q, want %q", tt.style, got, tt.want)
+		}
+	}
+}
+
+func TestParseStyle(t *testing.T) {
+	tests := []struct {
+		style string
+		want  map[string]string
+	}{
+		{"", map[string]string{}},
+		{
+			"Width: 10px; height:20px;",
+			map[string]string{"width": "10px", "height": "20px"},
+		},
+		{
+			"background-image: url(data:image/png;base64,iVBORw0KGgo=);width:1px",
+			map[string]string{"background-image": "url(data:image/png;base64,iVBORw0KGgo=)", "width": "1px"},
+		},
+		{
+			// colon in value is kept, empty and invalid declarations are skipped
+			"background: url('http://cdn.example.com/a;b.png') no-repeat; ;bad",
+			map[string]string{"background": "url('http://cdn.example.com/a;b.png') no-repeat"},
+		},
+	}
+	for _, tt := range tests {
+		n := &html.Node{Type: html.ElementNode, Data: "div", Attr: []html.Attribute{{Key: "style", Val: tt.style}}}
+		if got := parseStyle(n); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseStyle(%q) = %q, want %q", tt.style, got, tt.want)
+		}
+	}
+}
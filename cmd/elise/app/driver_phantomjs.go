@@ -0,0 +1,116 @@
+package app
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/sclevine/agouti"
+)
+
+// phantomEmulateScript run in phantomjs context by ghostdriver, 'this' is the page
+const phantomEmulateScript = `var page = this, p = arguments[0];
+if (p.userAgent) page.settings.userAgent = p.userAgent;
+page.customHeaders = p.headers;
+if (p.width > 0) page.viewportSize = {width: p.width, height: p.height};
+p.cookies.forEach(function(c) { phantom.addCookie(c); });`
+
+type phantomJSDriver struct {
+	*agouti.WebDriver
+}
+
+func newPhantomJSDriver() Driver {
+	return &phantomJSDriver{agouti.PhantomJS()}
+}
+
+func (d *phantomJSDriver) NewPage() (Page, error) {
+	return d.newPage(agouti.Browser("phantomjs"))
+}
+
+// NewProxyPage create session using proxy by ghostdriver proxy capability
+func (d *phantomJSDriver) NewProxyPage(proxy *url.URL) (Page, error) {
+	config := agouti.ProxyConfig{ProxyType: "manual"}
+	if proxy.Scheme == "socks5" {
+		config.SOCKSProxy = proxy.Host
+		if proxy.User != nil {
+			config.SOCKSUsername = proxy.User.Username()
+			config.SOCKSPassword, _ = proxy.User.Password()
+		}
+	} else {
+		config.HTTPProxy = proxy.Host
+		config.SSLProxy = proxy.Host
+	}
+	return d.newPage(agouti.Desired(agouti.NewCapabilities().Browser("phantomjs").Proxy(config)))
+}
+
+func (d *phantomJSDriver) newPage(options ...agouti.Option) (Page, error) {
+	page, err := d.WebDriver.NewPage(options...)
+	if err != nil {
+		return nil, err
+	}
+
+	page.Session().SetPageLoad(300000)
+	page.Session().SetScriptTimeout(30000)
+	page.Session().SetImplicitWait(0)
+
+	return &phantomJSPage{page}, nil
+}
+
+type phantomJSPage struct {
+	*agouti.Page
+}
+
+func (p *phantomJSPage) SetTimeouts(pageLoad, script time.Duration) error {
+	if pageLoad > 0 {
+		if err := p.Session().SetPageLoad(int(pageLoad / time.Millisecond)); err != nil {
+			return err
+		}
+	}
+	if script > 0 {
+		return p.Session().SetScriptTimeout(int(script / time.Millisecond))
+	}
+	return nil
+}
+
+// NetworkEntries read the 'har' log of ghostdriver
+func (p *phantomJSPage) NetworkEntries() ([]NetworkEntry, error) {
+	logs, err := p.ReadAllLogs("har")
+	if err != nil {
+		return nil, err
+	}
+	var entries []NetworkEntry
+	for _, l := range logs {
+		e, err := parseHAR([]byte(l.Message))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e...)
+	}
+	return entries, nil
+}
+
+// Emulate apply profile by phantomjs script, locale is only sent as Accept-Language,
+// timezone is not supported
+func (p *phantomJSPage) Emulate(profile *Profile, url string) error {
+	type cookie struct {
+		Name   string `json:"name"`
+		Value  string `json:"value"`
+		Domain string `json:"domain"`
+		Path   string `json:"path"`
+	}
+	cookies := []cookie{}
+	for _, c := range profile.CookiesFor(url) {
+		cookies = append(cookies, cookie{c.Name, c.Value, c.Domain, c.Path})
+	}
+	args := map[string]interface{}{
+		"userAgent": profile.UserAgent,
+		"headers":   profile.RequestHeaders(),
+		"width":     profile.Viewport.Width,
+		"height":    profile.Viewport.Height,
+		"cookies":   cookies,
+	}
+	body := map[string]interface{}{
+		"script": phantomEmulateScript,
+		"args":   []interface{}{args},
+	}
+	return p.Session().Execute("phantom/execute", "POST", body)
+}
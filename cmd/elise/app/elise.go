@@ -20,6 +20,7 @@ var (
 	fEliseSplitCnt   int
 	fEliseDevMode    bool
 	fEliseBufMaxSize int
+	fEliseDebugAddr  string
 )
 
 func init() {
@@ -28,6 +29,7 @@ func init() {
 	EliseCmd.AddCommand(PicCmd)
 	EliseCmd.AddCommand(WebCmd)
 	EliseCmd.AddCommand(ConvCmd)
+	EliseCmd.AddCommand(ConfigCmd)
 
 	pflags := EliseCmd.PersistentFlags()
 	pflags.IntVarP(&fEliseParallel, "parallel", "P", 10, "max number of parallel exector")
@@ -39,6 +41,7 @@ func init() {
 	pflags.IntVarP(&fEliseSplitCnt, "splitCount", "c", 1000, "max line count for one output file")
 	pflags.BoolVarP(&fEliseDevMode, "devMode", "D", false, "develop mode, use local files which not embeded in binary")
 	pflags.IntVarP(&fEliseBufMaxSize, "maxSize", "S", 16, "buffer max size for scanner, in Mega byte")
+	pflags.StringVar(&fEliseDebugAddr, "debugAddr", "127.0.0.1:5196", "listen address for /debug/pprof and /metrics, empty means disabled")
 }
 
 var EliseCmd = &cobra.Command{
@@ -63,6 +66,11 @@ var EliseCmd = &cobra.Command{
 		}))
 		log.SetLevel(log.Level(fEliseVerbose))
 
+		// /debug/pprof for profile, /metrics for prometheus
+		if fEliseDebugAddr != "" {
+			go serveDebug(fEliseDebugAddr)
+		}
+
 		if fEliseInPath != "-" {
 			if _, err := os.Stat(fEliseInPath); os.IsNotExist(err) {
 				return err
@@ -0,0 +1,165 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// Field declare one value extracted from page without writing javascript,
+// text of the matched element is extracted unless Attr, Style or HTML is set
+type Field struct {
+	Key   string `json:"key"` // '{i}' in key is replaced by index for list
+	CSS   string `json:"css,omitempty"`
+	XPath string `json:"xpath,omitempty"`
+	Attr  string `json:"attr,omitempty"`  // src and href are resolved to absolute urls
+	Style string `json:"style,omitempty"` // computed style property, eg: background-image
+	HTML  bool   `json:"html,omitempty"`
+	List  bool   `json:"list,omitempty"` // all matched elements instead of the Index-th
+	Index int    `json:"index"`
+}
+
+// parseFields read 'fields' conf of data file
+//
+//	fields:
+//	  - key: product_name_0
+//	    css: .title
+//	  - key: product_img{i}_0
+//	    xpath: //div[@class="banner"]//img
+//	    attr: src
+//	    list: true
+func parseFields(val interface{}) ([]Field, error) {
+	items, ok := val.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("fields is not an array")
+	}
+	var fields []Field
+	for i, item := range items {
+		conf, err := cast.ToStringMapE(item)
+		if err != nil {
+			return nil, fmt.Errorf("fields[%d] is not a map", i)
+		}
+		var f Field
+		for key, v := range conf {
+			switch key {
+			case "key":
+				f.Key, err = cast.ToStringE(v)
+			case "css":
+				f.CSS, err = cast.ToStringE(v)
+			case "xpath":
+				f.XPath, err = cast.ToStringE(v)
+			case "attr":
+				f.Attr, err = cast.ToStringE(v)
+			case "style":
+				f.Style, err = cast.ToStringE(v)
+			case "html":
+				f.HTML, err = cast.ToBoolE(v)
+			case "list":
+				f.List, err = cast.ToBoolE(v)
+			case "index":
+				f.Index, err = cast.ToIntE(v)
+			default:
+				return nil, fmt.Errorf("fields[%d] has unknown item %q", i, key)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("fields[%d].%s is invalid: %v", i, key, err)
+			}
+		}
+		if err := f.validate(); err != nil {
+			return nil, fmt.Errorf("fields[%d]: %v", i, err)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func (f Field) validate() error {
+	if f.Key == "" {
+		return fmt.Errorf("no key")
+	}
+	if (f.CSS == "") == (f.XPath == "") {
+		return fmt.Errorf("one and only one of css and xpath should be set")
+	}
+	n := 0
+	for _, set := range []bool{f.Attr != "", f.Style != "", f.HTML} {
+		if set {
+			n++
+		}
+	}
+	if n > 1 {
+		return fmt.Errorf("at most one of attr, style and html can be set")
+	}
+	if f.Index < 0 {
+		return fmt.Errorf("index should not be negative")
+	}
+	if !f.List && strings.Contains(f.Key, "{i}") {
+		return fmt.Errorf("'{i}' in key is only for list")
+	}
+	return nil
+}
+
+// fieldsScriptTmpl only use DOM api supported by all drivers
+const fieldsScriptTmpl = `var fields = %s;
+var result = {};
+
+function query(f) {
+  if (f.xpath) {
+    var snap = document.evaluate(f.xpath, document, null, 7, null);
+    var nodes = [];
+    for (var i = 0; i < snap.snapshotLength; i++) {
+      nodes.push(snap.snapshotItem(i));
+    }
+    return nodes;
+  }
+  return [].slice.call(document.querySelectorAll(f.css));
+}
+
+function extract(f, node) {
+  if (node.nodeType === 2 || node.nodeType === 3) {
+    return node.nodeValue;
+  }
+  if (f.attr) {
+    if (f.attr === 'src' || f.attr === 'href') {
+      return node[f.attr] || node.getAttribute(f.attr);
+    }
+    return node.getAttribute(f.attr);
+  }
+  if (f.style) {
+    return window.getComputedStyle(node).getPropertyValue(f.style);
+  }
+  if (f.html) {
+    return node.innerHTML;
+  }
+  return (node.textContent || '').trim();
+}
+
+fields.forEach(function(f) {
+  var nodes = query(f);
+  if (!f.list) {
+    if (f.index < nodes.length) {
+      result[f.key] = extract(f, nodes[f.index]);
+    }
+    return;
+  }
+  var values = nodes.map(function(node) { return extract(f, node); });
+  if (f.key.indexOf('{i}') === -1) {
+    result[f.key] = values;
+    return;
+  }
+  values.forEach(function(val, i) {
+    result[f.key.replace('{i}', i)] = val;
+  });
+});
+
+return result;`
+
+// fieldsScript compile fields into script run after the scripts of data file
+func fieldsScript(fields []Field) (string, error) {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(fieldsScriptTmpl, data), nil
+}
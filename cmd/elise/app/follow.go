@@ -0,0 +1,162 @@
+package app
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cast"
+	"golang.org/x/net/publicsuffix"
+)
+
+// FollowRule decide which links in page are crawled too, it's shared by all urls of one data file
+type FollowRule struct {
+	Selector string         // css selector of links
+	Pattern  *regexp.Regexp // absolute url must match, nil means any
+	MaxDepth int            // depth of seed is 0
+	Scope    string         // same_domain, same_host or allowlist
+	Allow    []string       // domains for allowlist scope, subdomains are included
+	MaxPages int            // max pages crawled for one seed include itself, 0 means no limit
+
+	mu sync.Mutex // guard pages of seeds
+}
+
+// followSeed count pages crawled from one seed
+type followSeed struct {
+	pages int
+}
+
+// parseFollowRule read 'follow' conf of data file
+//
+//	follow:
+//	  selector: a.product
+//	  pattern: /item/\d+
+//	  max_depth: 1
+//	  scope: allowlist
+//	  allow: [example.com, example.net]
+//	  max_pages: 100
+func parseFollowRule(val interface{}) (*FollowRule, error) {
+	conf, err := cast.ToStringMapE(val)
+	if err != nil {
+		return nil, err
+	}
+	rule := &FollowRule{
+		Selector: "a[href]",
+		MaxDepth: 1,
+		Scope:    "same_domain",
+	}
+	for key, v := range conf {
+		switch key {
+		case "selector":
+			rule.Selector, err = cast.ToStringE(v)
+		case "pattern":
+			var pattern string
+			if pattern, err = cast.ToStringE(v); err == nil {
+				rule.Pattern, err = regexp.Compile(pattern)
+			}
+		case "max_depth":
+			rule.MaxDepth, err = cast.ToIntE(v)
+		case "scope":
+			rule.Scope, err = cast.ToStringE(v)
+		case "allow":
+			rule.Allow, err = cast.ToStringSliceE(v)
+		case "max_pages":
+			rule.MaxPages, err = cast.ToIntE(v)
+		default:
+			return nil, fmt.Errorf("unknown follow conf %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid follow conf %q: %v", key, err)
+		}
+	}
+	switch rule.Scope {
+	case "same_domain", "same_host":
+	case "allowlist":
+		if len(rule.Allow) == 0 {
+			return nil, fmt.Errorf("allow should be set for allowlist scope")
+		}
+	default:
+		return nil, fmt.Errorf("scope should be one of same_domain, same_host and allowlist")
+	}
+	if rule.MaxDepth < 1 {
+		return nil, fmt.Errorf("max_depth should be at least 1")
+	}
+	return rule, nil
+}
+
+// Links return href of links in page, relative urls have been resolved by page
+func (r *FollowRule) Links(page Page) ([]string, error) {
+	const body = `return [].map.call(document.querySelectorAll(selector), function(a) {
+		return a.href || a.getAttribute('href') || '';
+	});`
+	var links []string
+	err := page.RunScript(body, map[string]interface{}{"selector": r.Selector}, &links)
+	return links, err
+}
+
+// Filter return links which should be crawled from parent,
+// links seen by data file are skipped, pages of seed are counted
+func (r *FollowRule) Filter(parent URLInfo, links []string) []string {
+	base, err := url.Parse(parent.URL)
+	if err != nil {
+		return nil
+	}
+	seedURL, err := url.Parse(parent.SeedURL)
+	if err != nil {
+		return nil
+	}
+
+	var urls []string
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, link := range links {
+		if r.MaxPages > 0 && parent.Seed.pages >= r.MaxPages {
+			break
+		}
+		u, err := base.Parse(strings.TrimSpace(link))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+		u.Fragment = ""
+		if !r.inScope(seedURL, u) {
+			continue
+		}
+		if r.Pattern != nil && !r.Pattern.MatchString(u.String()) {
+			continue
+		}
+		if !parent.Seen.Add(u.String()) {
+			continue
+		}
+		parent.Seed.pages++
+		urls = append(urls, u.String())
+	}
+	return urls
+}
+
+func (r *FollowRule) inScope(seed, u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	switch r.Scope {
+	case "same_host":
+		return host == strings.ToLower(seed.Hostname())
+	case "allowlist":
+		for _, domain := range r.Allow {
+			domain = strings.ToLower(domain)
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		}
+		return false
+	}
+	return registeredDomain(host) == registeredDomain(strings.ToLower(seed.Hostname()))
+}
+
+// registeredDomain return 'example.com' for 'www.example.com'
+func registeredDomain(host string) string {
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
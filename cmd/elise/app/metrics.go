@@ -0,0 +1,125 @@
+package app
+
+import (
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ensonmj/fileproc"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	metricPageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "elise_crawl_page_duration_seconds",
+		Help:    "Time to crawl one page, from creating session to getting result.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 12), // 0.1s ~ 204.8s
+	}, []string{"driver", "result"})
+	metricDriverRestarts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "elise_crawl_driver_restarts_total",
+		Help: "Drivers stopped after failure, they are restarted when used next time.",
+	}, []string{"driver"})
+	metricRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "elise_crawl_retries_total",
+		Help: "Urls pushed back to retry, by kind of error.",
+	}, []string{"kind"})
+	metricDomainRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "elise_crawl_domain_requests_total",
+		Help: "Pages crawled per registered domain, result is ok or kind of error.",
+	}, []string{"domain", "result"})
+	metricFileprocLines = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "elise_fileproc_input_lines_total",
+		Help: "Lines passed to map of pic and conv.",
+	}, []string{"command"})
+	metricFileprocMapOut = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "elise_fileproc_map_output_total",
+		Help: "Lines output by map of pic and conv.",
+	}, []string{"command"})
+	metricFileprocReduceOut = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "elise_fileproc_reduce_output_total",
+		Help: "Lines output by reduce of pic and conv, added when finished.",
+	}, []string{"command"})
+	metricImgProbes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "elise_pic_image_probes_total",
+		Help: "Images probed for size by pic, result is cache, fetched or failed.",
+	}, []string{"result"})
+	metricImgHashes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "elise_pic_image_hashes_total",
+		Help: "Images downloaded for perceptual hash by pic, result is cache, fetched or failed.",
+	}, []string{"algo", "result"})
+)
+
+func init() {
+	prometheus.MustRegister(metricPageDuration, metricDriverRestarts, metricRetries, metricDomainRequests,
+		metricFileprocLines, metricFileprocMapOut, metricFileprocReduceOut, metricImgProbes,
+		metricImgHashes)
+}
+
+// serveDebug serve pprof and prometheus metrics, it's only for local debugging
+func serveDebug(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/metrics", promhttp.Handler())
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.WithFields(log.Fields{
+			"addr": addr,
+			"err":  err,
+		}).Warn("Failed to serve debug http")
+	}
+}
+
+// observePage record duration and result of crawling one page
+func observePage(info URLInfo, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = string(errKindOf(err))
+	}
+	metricPageDuration.WithLabelValues(info.Driver, result).Observe(time.Since(start).Seconds())
+	metricDomainRequests.WithLabelValues(metricDomain(info.URL), result).Inc()
+}
+
+// metricDomain bucket hosts by registered domain, so label values are bounded by sites
+// instead of every host a crawl touches, eg: subdomains of blogs
+func metricDomain(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return "invalid"
+	}
+	host := strings.ToLower(u.Hostname())
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	return registeredDomain(host)
+}
+
+// countedMapper count lines in and out of fileproc mapper
+type countedMapper struct {
+	fileproc.Mapper
+	lines, out prometheus.Counter
+}
+
+func newCountedMapper(command string, m fileproc.Mapper) fileproc.Mapper {
+	return &countedMapper{
+		Mapper: m,
+		lines:  metricFileprocLines.WithLabelValues(command),
+		out:    metricFileprocMapOut.WithLabelValues(command),
+	}
+}
+
+func (m *countedMapper) Map(line []byte) []byte {
+	m.lines.Inc()
+	res := m.Mapper.Map(line)
+	if res != nil {
+		m.out.Inc()
+	}
+	return res
+}
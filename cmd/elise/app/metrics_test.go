@@ -0,0 +1,25 @@
+package app
+
+import "testing"
+
+func TestMetricDomain(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://www.example.com/a", "example.com"},
+		{"https://Blog1.Example.COM:8443/a", "example.com"},
+		{"http://a.b.example.co.uk/", "example.co.uk"},
+		{"http://alice.github.io/", "alice.github.io"},
+		{"http://127.0.0.1:8080/", "127.0.0.1"},
+		{"http://[::1]/", "::1"},
+		{"http://localhost/", "localhost"},
+		{"/relative", "invalid"},
+		{"http://exa mple.com/", "invalid"},
+	}
+	for _, tt := range tests {
+		if got := metricDomain(tt.url); got != tt.want {
+			t.Errorf("metricDomain(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// NetworkEntry is one request made by page, every hop of a redirect chain is an entry
+type NetworkEntry struct {
+	URL         string    `json:"url"`
+	Method      string    `json:"method"`
+	Status      int       `json:"status"` // 0 when no response
+	ContentType string    `json:"content_type,omitempty"`
+	Size        int64     `json:"size"` // bytes received, -1 when unknown
+	RedirectURL string    `json:"redirect_url,omitempty"`
+	Start       time.Time `json:"start"`
+	Time        float64   `json:"time"` // milliseconds
+	Error       string    `json:"error,omitempty"`
+}
+
+// networkRecorder is implemented by pages which can record requests made since created
+type networkRecorder interface {
+	NetworkEntries() ([]NetworkEntry, error)
+}
+
+// captureNetwork return requests made by page, mode is "compact" or "har"
+func captureNetwork(page Page, mode string) (interface{}, error) {
+	p, ok := page.(networkRecorder)
+	if !ok {
+		return nil, fmt.Errorf("driver can't record network")
+	}
+	entries, err := p.NetworkEntries()
+	if err != nil {
+		return nil, err
+	}
+	if mode == "har" {
+		return newHAR(entries), nil
+	}
+	return entries, nil
+}
+
+// har is the subset of HAR 1.2 we can fill, headers and cookies are always empty
+type har struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harRequest struct {
+	Method      string        `json:"method"`
+	URL         string        `json:"url"`
+	HTTPVersion string        `json:"httpVersion"`
+	Cookies     []interface{} `json:"cookies"`
+	Headers     []interface{} `json:"headers"`
+	QueryString []interface{} `json:"queryString"`
+	HeadersSize int           `json:"headersSize"`
+	BodySize    int           `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int           `json:"status"`
+	StatusText  string        `json:"statusText"`
+	HTTPVersion string        `json:"httpVersion"`
+	Cookies     []interface{} `json:"cookies"`
+	Headers     []interface{} `json:"headers"`
+	Content     harContent    `json:"content"`
+	RedirectURL string        `json:"redirectURL"`
+	HeadersSize int           `json:"headersSize"`
+	BodySize    int64         `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+func newHAR(entries []NetworkEntry) *har {
+	h := &har{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "elise", Version: gVersion},
+		Entries: []harEntry{},
+	}}
+	for _, e := range entries {
+		h.Log.Entries = append(h.Log.Entries, harEntry{
+			StartedDateTime: e.Start.Format(time.RFC3339Nano),
+			Time:            e.Time,
+			Request: harRequest{
+				Method:      e.Method,
+				URL:         e.URL,
+				HTTPVersion: "HTTP/1.1",
+				Cookies:     []interface{}{},
+				Headers:     []interface{}{},
+				QueryString: []interface{}{},
+				HeadersSize: -1,
+				BodySize:    -1,
+			},
+			Response: harResponse{
+				Status:      e.Status,
+				HTTPVersion: "HTTP/1.1",
+				Cookies:     []interface{}{},
+				Headers:     []interface{}{},
+				Content:     harContent{Size: e.Size, MimeType: e.ContentType},
+				RedirectURL: e.RedirectURL,
+				HeadersSize: -1,
+				BodySize:    e.Size,
+			},
+			Timings: harTimings{Send: 0, Wait: e.Time, Receive: 0},
+			Comment: e.Error,
+		})
+	}
+	return h
+}
+
+// parseHAR convert HAR produced by browser to entries
+func parseHAR(data []byte) ([]NetworkEntry, error) {
+	var h har
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, err
+	}
+	var entries []NetworkEntry
+	for _, e := range h.Log.Entries {
+		start, _ := time.Parse(time.RFC3339Nano, e.StartedDateTime)
+		entries = append(entries, NetworkEntry{
+			URL:         e.Request.URL,
+			Method:      e.Request.Method,
+			Status:      e.Response.Status,
+			ContentType: e.Response.Content.MimeType,
+			Size:        e.Response.BodySize,
+			RedirectURL: e.Response.RedirectURL,
+			Start:       start,
+			Time:        e.Time,
+		})
+	}
+	return entries, nil
+}
+
+func millisecondsSince(start time.Time) float64 {
+	return float64(time.Since(start)) / float64(time.Millisecond)
+}
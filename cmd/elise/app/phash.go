@@ -0,0 +1,280 @@
+package app
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"math/bits"
+	"net/url"
+	"sort"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// uniformStddev is the max standard deviation of gray levels of uniform image
+const uniformStddev = 2.0
+
+// imgHashFuncs compute 64 bits perceptual hash of image, similar images have
+// hashes with small hamming distance
+var imgHashFuncs = map[string]func(img image.Image) uint64{
+	"ahash": averageHash,
+	"dhash": differenceHash,
+	"phash": perceptionHash,
+}
+
+func imgHashNames() []string {
+	var names []string
+	for name := range imgHashFuncs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Hash download image and return its perceptual hash by algo in hex.
+// Uniform images have empty hash, eg: blank placeholders, or they would be
+// near to each other whatever their colors are.
+func (p *ImgProber) Hash(src, algo string) (string, error) {
+	hashFunc, ok := imgHashFuncs[algo]
+	if !ok {
+		return "", fmt.Errorf("unknown hash %q, should be one of %v", algo, imgHashNames())
+	}
+	var hash imgHash
+	err := p.probe(algo, src, &hash, func(r io.Reader) (interface{}, error) {
+		img, _, err := image.Decode(r)
+		if err != nil {
+			return nil, err
+		}
+		return imgHash{Hash: hashImage(img, hashFunc)}, nil
+	})
+	return hash.Hash, err
+}
+
+// hashImage return hash in hex, empty for uniform image
+func hashImage(img image.Image, hashFunc func(img image.Image) uint64) string {
+	if isUniform(img) {
+		return ""
+	}
+	return fmt.Sprintf("%016x", hashFunc(img))
+}
+
+// isUniform return true if gray levels of 16x16 image barely change
+func isUniform(img image.Image) bool {
+	pixels := grayResize(img, 16, 16)
+	var sum, sq float64
+	for _, p := range pixels {
+		sum += p
+		sq += p * p
+	}
+	n := float64(len(pixels))
+	mean := sum / n
+	return math.Sqrt(math.Max(0, sq/n-mean*mean)) < uniformStddev
+}
+
+// imgHash is cached as json object like size
+type imgHash struct {
+	Hash string `json:"hash"`
+}
+
+// hashDistance is the hamming distance of hex hashes, -1 if any of them is invalid
+func hashDistance(a, b string) int {
+	x, err := strconv.ParseUint(a, 16, 64)
+	if err != nil {
+		return -1
+	}
+	y, err := strconv.ParseUint(b, 16, 64)
+	if err != nil {
+		return -1
+	}
+	return bits.OnesCount64(x ^ y)
+}
+
+// nearImg return index of the first image near to img, -1 if not found
+func nearImg(imgs []ImgItem, img ImgItem, distance int) int {
+	if img.Hash == "" {
+		return -1
+	}
+	for i, c := range imgs {
+		if d := hashDistance(c.Hash, img.Hash); d >= 0 && d <= distance {
+			return i
+		}
+	}
+	return -1
+}
+
+// dedupImgsByHash set hash of images and remove the ones near to former images,
+// eg: copies on cdn, resized or with cache buster. Images failed to hash and
+// uniform images are kept.
+func dedupImgsByHash(p *ImgProber, algo string, distance int, imgItems []ImgItem) []ImgItem {
+	var srcs []string
+	seen := make(map[string]bool)
+	for _, img := range imgItems {
+		if !seen[img.Src] {
+			seen[img.Src] = true
+			srcs = append(srcs, img.Src)
+		}
+	}
+	// prefetch concurrently, results are cached by prober
+	p.each(srcs, func(src string) { p.Hash(src, algo) })
+
+	var uniq []ImgItem
+	for _, img := range imgItems {
+		img.Hash, _ = p.Hash(img.Src, algo)
+		if i := nearImg(uniq, img, distance); i >= 0 {
+			log.WithFields(log.Fields{
+				"imgSrc":  img.Src,
+				"nearSrc": uniq[i].Src,
+				"hash":    img.Hash,
+			}).Info("Filtered by perceptual hash")
+			continue
+		}
+		uniq = append(uniq, img)
+	}
+	return uniq
+}
+
+// dedupGroupsByHash remove images near to the ones in groups with higher score, groups
+// changed are scored again, and dropped if image num is under threshold
+func dedupGroupsByHash(sgs ScoredGrpSlice, distance int, lpURL *url.URL, scorer *Scorer) ScoredGrpSlice {
+	var kept []ImgItem // images of former groups
+	var res ScoredGrpSlice
+	for _, sg := range sgs {
+		var imgItems []ImgItem
+		for _, img := range sg.ImgItems {
+			if i := nearImg(kept, img, distance); i >= 0 {
+				log.WithFields(log.Fields{
+					"imgSrc":  img.Src,
+					"nearSrc": kept[i].Src,
+					"hash":    img.Hash,
+				}).Info("Filtered by perceptual hash of former group")
+				continue
+			}
+			imgItems = append(imgItems, img)
+		}
+		if len(imgItems) < len(sg.ImgItems) {
+			if len(imgItems) < fImgNumMin || len(imgItems) == 0 {
+				log.WithFields(log.Fields{
+					"num":    len(imgItems),
+					"minNum": fImgNumMin,
+				}).Info("Image num under threshold after dedup")
+				continue
+			}
+			sg.ImgItems = imgItems
+			sg.Score, _ = scorer.Score(&ImgGroup{ImgItems: imgItems, LP: lpURL})
+		}
+		kept = append(kept, imgItems...)
+		res = append(res, sg)
+	}
+	sort.Stable(res)
+	return res
+}
+
+// grayResize convert image to gray and resize it to w*h by area average
+func grayResize(img image.Image, w, h int) []float64 {
+	bounds := img.Bounds()
+	pixels := make([]float64, w*h)
+	for cy := 0; cy < h; cy++ {
+		y0 := bounds.Min.Y + cy*bounds.Dy()/h
+		y1 := bounds.Min.Y + (cy+1)*bounds.Dy()/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for cx := 0; cx < w; cx++ {
+			x0 := bounds.Min.X + cx*bounds.Dx()/w
+			x1 := bounds.Min.X + (cx+1)*bounds.Dx()/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var sum float64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					r, g, b, _ := img.At(x, y).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+				}
+			}
+			pixels[cy*w+cx] = sum / float64((y1-y0)*(x1-x0)) / 257
+		}
+	}
+	return pixels
+}
+
+// averageHash set bit for pixel brighter than mean of 8x8 gray image
+func averageHash(img image.Image) uint64 {
+	pixels := grayResize(img, 8, 8)
+	var mean float64
+	for _, p := range pixels {
+		mean += p
+	}
+	mean /= float64(len(pixels))
+	var hash uint64
+	for i, p := range pixels {
+		if p > mean {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// differenceHash set bit for pixel darker than its right one of 9x8 gray image
+func differenceHash(img image.Image) uint64 {
+	pixels := grayResize(img, 9, 8)
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if pixels[y*9+x] < pixels[y*9+x+1] {
+				hash |= 1 << uint(y*8+x)
+			}
+		}
+	}
+	return hash
+}
+
+// perceptionHash set bit for the lowest 8x8 frequencies of 32x32 gray image by
+// DCT, which are greater than their median
+func perceptionHash(img image.Image) uint64 {
+	const n = 32
+	pixels := grayResize(img, n, n)
+	// 2D DCT-II is separable, rows first then columns
+	rows := make([]float64, n*n)
+	for y := 0; y < n; y++ {
+		dct(pixels[y*n:(y+1)*n], rows[y*n:(y+1)*n])
+	}
+	coeffs := make([]float64, 64)
+	col := make([]float64, n)
+	out := make([]float64, n)
+	for x := 0; x < 8; x++ {
+		for y := 0; y < n; y++ {
+			col[y] = rows[y*n+x]
+		}
+		dct(col, out)
+		for y := 0; y < 8; y++ {
+			coeffs[y*8+x] = out[y]
+		}
+	}
+
+	// DC is excluded from median, it's the average brightness
+	sorted := append([]float64(nil), coeffs[1:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+	var hash uint64
+	for i, c := range coeffs {
+		if c > median {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// dct is 1D DCT-II of in, scale is ignored since only the order is used
+func dct(in, out []float64) {
+	n := len(in)
+	for k := 0; k < n; k++ {
+		var sum float64
+		for i, v := range in {
+			sum += v * math.Cos(math.Pi/float64(n)*(float64(i)+0.5)*float64(k))
+		}
+		out[k] = sum
+	}
+}
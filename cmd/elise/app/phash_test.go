@@ -0,0 +1,120 @@
+package app
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// blobImage draw random blobs on gradient, the same seed draws the same picture in any size
+func blobImage(w, h int, seed int64) image.Image {
+	type blob struct{ x, y, r, v float64 }
+	rnd := rand.New(rand.NewSource(seed))
+	var blobs []blob
+	for i := 0; i < 12; i++ {
+		blobs = append(blobs, blob{rnd.Float64(), rnd.Float64(), 0.05 + 0.2*rnd.Float64(), 70 * rnd.Float64()})
+	}
+	freq := 2 + 4*rnd.Float64()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			fx, fy := float64(x)/float64(w), float64(y)/float64(h)
+			v := 40 + 30*math.Sin(fx*freq)
+			for _, b := range blobs {
+				if (fx-b.x)*(fx-b.x)+(fy-b.y)*(fy-b.y) < b.r*b.r {
+					v += b.v
+				}
+			}
+			v = math.Min(v, 255)
+			img.Set(x, y, color.RGBA{uint8(v), uint8(255 - v), uint8(v / 2), 255})
+		}
+	}
+	return img
+}
+
+// reencode return image compressed by jpeg, like copies on cdn
+func reencode(t *testing.T, img image.Image, quality int) image.Image {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	img, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestImgHashFuncs(t *testing.T) {
+	distance := 6 // default of --dedupDistance
+	orig := blobImage(400, 300, 1)
+	copies := map[string]image.Image{
+		"resized":   blobImage(200, 150, 1),
+		"jpeg":      reencode(t, orig, 60),
+		"thumbnail": reencode(t, blobImage(120, 90, 1), 75),
+	}
+	others := map[string]image.Image{
+		"seed 2": blobImage(400, 300, 2),
+		"seed 3": blobImage(400, 300, 3),
+		"seed 4": blobImage(400, 300, 4),
+	}
+	for _, algo := range imgHashNames() {
+		hashFunc := imgHashFuncs[algo]
+		h := hashImage(orig, hashFunc)
+		for name, img := range copies {
+			if d := hashDistance(h, hashImage(img, hashFunc)); d < 0 || d > distance {
+				t.Errorf("%s: distance of %s copy = %d, want <= %d", algo, name, d, distance)
+			}
+		}
+		for name, img := range others {
+			if d := hashDistance(h, hashImage(img, hashFunc)); d <= distance {
+				t.Errorf("%s: distance of image %s = %d, want > %d", algo, name, d, distance)
+			}
+		}
+	}
+}
+
+func TestHashUniformImage(t *testing.T) {
+	for _, c := range []color.Color{color.White, color.Black, color.RGBA{200, 30, 30, 255}} {
+		img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+		for y := 0; y < 100; y++ {
+			for x := 0; x < 100; x++ {
+				img.Set(x, y, c)
+			}
+		}
+		for _, algo := range imgHashNames() {
+			if h := hashImage(img, imgHashFuncs[algo]); h != "" {
+				t.Errorf("%s: hash of uniform image %v = %q, want empty", algo, c, h)
+			}
+		}
+	}
+	// blank placeholders are not near to each other
+	imgs := []ImgItem{{Src: "a.gif"}, {Src: "b.gif"}}
+	if i := nearImg(imgs[:1], imgs[1], 64); i >= 0 {
+		t.Errorf("nearImg of images without hash = %d, want -1", i)
+	}
+}
+
+func TestHashDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"0000000000000000", "0000000000000000", 0},
+		{"0000000000000000", "0000000000000001", 1},
+		{"ffffffffffffffff", "0000000000000000", 64},
+		{"f0f0f0f0f0f0f0f0", "0f0f0f0f0f0f0f0f", 64},
+		{"00000000000000ff", "000000000000000f", 4},
+		{"", "0000000000000000", -1},
+		{"xyz", "0000000000000000", -1},
+	}
+	for _, tt := range tests {
+		if got := hashDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("hashDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -11,15 +11,14 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/PuerkitoBio/goquery"
 	log "github.com/Sirupsen/logrus"
-	"github.com/ensonmj/elise/cmd/elise/conf"
 	"github.com/ensonmj/elise/htmlutil"
 	"github.com/ensonmj/fileproc"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 	"github.com/yosssi/gohtml"
 	"golang.org/x/net/html"
 )
@@ -33,6 +32,16 @@ var (
 	fOTrim     bool
 	fPicDelim  string
 	fPicField  int
+
+	fPicProbe         bool
+	fPicProbeParallel int
+	fPicProbeTimeout  time.Duration
+	fPicProbeCacheDir string
+	fPicDedupHash     string
+	fPicDedupDistance int
+
+	picConf   *PicConf
+	imgProber *ImgProber // nil if neither probe nor dedup by hash is enabled
 )
 
 func init() {
@@ -45,6 +54,12 @@ func init() {
 	flags.BoolVarP(&fOTrim, "outputTrim", "o", false, "print HTML after trimming")
 	flags.StringVarP(&fPicDelim, "delimiter", "d", "\t", "field delimiter")
 	flags.IntVarP(&fPicField, "field", "f", 2, "nth field for process, index start from 1")
+	flags.BoolVar(&fPicProbe, "probe", false, "fetch header bytes of images without size to get their natural size")
+	flags.IntVar(&fPicProbeParallel, "probeParallel", 16, "max number of images probed or downloaded for hash at the same time")
+	flags.DurationVar(&fPicProbeTimeout, "probeTimeout", 10*time.Second, "timeout for probing or downloading one image, 0 means no timeout")
+	flags.StringVar(&fPicProbeCacheDir, "probeCacheDir", "./cache/img", "dir for caching probed images, each kind of result is in its sub dir, eg: size, phash, empty means no disk cache")
+	flags.StringVar(&fPicDedupHash, "dedupHash", "", "download images to remove near duplicates by perceptual hash: ahash, dhash or phash, empty means disabled")
+	flags.IntVar(&fPicDedupDistance, "dedupDistance", 6, "max hamming distance of 64 bits hashes for near duplicates")
 }
 
 type TextInfo struct {
@@ -55,16 +70,21 @@ type TextInfo struct {
 type CrawlerResp struct {
 	LandingPage string `json:"final_url"`
 	// Title       string `json:"title"`
-	HTML string `json:"html"`
+	HTML       string `json:"html"`
+	Screenshot string `json:"screenshot"` // relative to crawl output dir
 }
 
 type ImgItem struct {
 	Src                             string
 	Top, Left, Width, Height, Ratio float64
+	Depth                           int    `json:"-"` // in DOM, for scoring
+	Origin                          string // img or background
+	SrcWidth                        int    `json:",omitempty"` // width descriptor of srcset
+	Hash                            string `json:",omitempty"` // perceptual hash in hex
 }
 
 type ScoredGrp struct {
-	Score    int
+	Score    float64
 	ImgItems []ImgItem
 }
 
@@ -84,15 +104,17 @@ func (sgs ScoredGrpSlice) Less(i, j int) bool {
 }
 
 type PicDesc struct {
-	OrigLP  string
-	LP      string
-	Title   string
-	SGSlice ScoredGrpSlice
+	OrigLP     string
+	LP         string
+	Title      string
+	Screenshot string `json:",omitempty"`
+	SGSlice    ScoredGrpSlice
 }
 
 type picProcessor struct {
 	blackWords []string
 	presuffix  string
+	scorer     *Scorer
 }
 
 func (w *picProcessor) Map(line []byte) []byte {
@@ -111,10 +133,11 @@ func (w *picProcessor) Map(line []byte) []byte {
 	}
 	origLP := string(fields[0])
 	lp := resp.LandingPage
-	picDesc, err := parseDoc(doc, origLP, lp, w.blackWords, w.presuffix)
+	picDesc, err := parseDoc(doc, origLP, lp, w.blackWords, w.presuffix, w.scorer)
 	if err != nil {
 		return nil
 	}
+	picDesc.Screenshot = resp.Screenshot
 
 	data, err := json.Marshal(picDesc)
 	if err != nil {
@@ -135,16 +158,18 @@ var PicCmd = &cobra.Command{
 	Long: `Check all pictures in the webpage, find the pictures which can best
 represent the webpage according to web structure and something else.`,
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		data, err := conf.FSByte(fEliseDevMode, "/conf/pic.yml")
-		if err != nil {
+		var err error
+		if picConf, err = loadPicConf(); err != nil {
 			return err
 		}
-		viper.SetConfigType("yml")
-		err = viper.ReadConfig(bytes.NewReader(data))
-		if err != nil {
-			return err
+		lazyAttrs = picConf.LazyAttrs
+		if _, ok := imgHashFuncs[fPicDedupHash]; fPicDedupHash != "" && !ok {
+			return fmt.Errorf("unknown hash %q, should be one of %v", fPicDedupHash, imgHashNames())
 		}
-		return nil
+		if fPicProbe || fPicDedupHash != "" {
+			imgProber, err = newImgProber(fPicProbeParallel, fPicProbeTimeout, fPicProbeCacheDir)
+		}
+		return err
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return pic()
@@ -152,20 +177,19 @@ represent the webpage according to web structure and something else.`,
 }
 
 func pic() error {
-	m := &picProcessor{}
-	if viper.IsSet("black_words_in_title") {
-		m.blackWords = append(m.blackWords, viper.GetStringSlice("black_words_in_title")...)
-	}
-	if viper.IsSet("post_trim_prefix_suffix") {
-		m.presuffix = viper.GetString("post_trim_prefix_suffix")
+	m := &picProcessor{
+		blackWords: picConf.BlackWordsInTitle,
+		presuffix:  picConf.PostTrimPrefixSuffix,
+		scorer:     picConf.Score,
 	}
 	fw := fileproc.DummyWrapper()
 	if fEliseInPath == "-" {
-		return fileproc.ProcTerm(fEliseParallel, fEliseBufMaxSize, m, nil, fw)
+		return fileproc.ProcTerm(fEliseParallel, fEliseBufMaxSize, newCountedMapper("pic", m), nil, fw)
 	}
-	fp := fileproc.NewFileProcessor(fEliseParallel, fEliseBufMaxSize, fEliseSplitCnt, true, false, m, nil, fw)
+	fp := fileproc.NewFileProcessor(fEliseParallel, fEliseBufMaxSize, fEliseSplitCnt, true, false, newCountedMapper("pic", m), nil, fw)
 	err := fp.ProcPath(fEliseInPath, fEliseOutputDir, ".json")
 	i, mc, r := fp.Stat()
+	metricFileprocReduceOut.WithLabelValues("pic").Add(float64(r))
 	log.WithFields(log.Fields{
 		"inputLineCnt": i,
 		"mapOutCnt":    mc,
@@ -174,7 +198,7 @@ func pic() error {
 	return err
 }
 
-func parseDoc(doc *goquery.Document, origLP, lp string, words []string, presuffix string) (*PicDesc, error) {
+func parseDoc(doc *goquery.Document, origLP, lp string, words []string, presuffix string, scorer *Scorer) (*PicDesc, error) {
 	origTitle := doc.Find("title").Text()
 	title := normalizeTitle(origTitle, words, presuffix)
 	if len(title) <= 0 {
@@ -182,11 +206,19 @@ func parseDoc(doc *goquery.Document, origLP, lp string, words []string, presuffi
 		return nil, errors.New("empty title")
 	}
 
+	markPictureSources(doc)
+	appendBackgroundImgs(doc)
 	trimHTML(doc)
 	if fOTrim {
 		str, _ := doc.Html()
 		fmt.Printf("%s\037%s\036\n", lp, gohtml.Format(str))
 	}
+	markImgDepth(doc)
+	if fPicProbe {
+		if lpURL, err := url.Parse(lp); err == nil {
+			prefetchImgSizes(imgProber, doc, lpURL)
+		}
+	}
 
 	tree := extractTree(doc)
 	if tree == nil {
@@ -194,7 +226,7 @@ func parseDoc(doc *goquery.Document, origLP, lp string, words []string, presuffi
 		return nil, errors.New("empty HTML body")
 	}
 
-	picDesc := sortTree(tree, lp)
+	picDesc := sortTree(tree, lp, scorer)
 	if picDesc == nil {
 		log.Debug("Empty PicDesc")
 		return nil, errors.New("Empty PicDesc")
@@ -282,7 +314,7 @@ func leafEqual(c, n *html.Node) bool {
 	return true
 }
 
-func sortTree(tree []*html.Node, lpSrc string) *PicDesc {
+func sortTree(tree []*html.Node, lpSrc string, scorer *Scorer) *PicDesc {
 	lpURL, err := url.Parse(lpSrc)
 	if err != nil {
 		log.WithFields(log.Fields{
@@ -293,9 +325,9 @@ func sortTree(tree []*html.Node, lpSrc string) *PicDesc {
 	}
 	var sgs ScoredGrpSlice
 	for _, n := range tree {
-		sg := calcScore(n, lpURL)
-		if sg.Score < 1 {
-			log.WithField("score", sg.Score).Debug("Score too low")
+		sg := calcScore(n, lpURL, scorer)
+		if len(sg.ImgItems) == 0 {
+			log.WithField("score", sg.Score).Debug("No image in group")
 			continue
 		}
 
@@ -305,20 +337,33 @@ func sortTree(tree []*html.Node, lpSrc string) *PicDesc {
 		return nil
 	}
 	sort.Sort(sgs)
+	if fPicDedupHash != "" {
+		if sgs = dedupGroupsByHash(sgs, fPicDedupDistance, lpURL, scorer); sgs.Len() < 1 {
+			return nil
+		}
+	}
 
 	return &PicDesc{SGSlice: sgs}
 }
 
-func calcScore(n *html.Node, lpURL *url.URL) ScoredGrp {
+func calcScore(n *html.Node, lpURL *url.URL, scorer *Scorer) ScoredGrp {
 	imgItems := extractImg(n, lpURL)
-	if len(imgItems) < fImgNumMin {
+	if fPicDedupHash != "" {
+		imgItems = dedupImgsByHash(imgProber, fPicDedupHash, fPicDedupDistance, imgItems)
+	}
+	if len(imgItems) < fImgNumMin || len(imgItems) == 0 {
 		log.WithFields(log.Fields{
 			"num":    len(imgItems),
 			"minNum": fImgNumMin,
 		}).Info("Image num under threshold")
 		return ScoredGrp{Score: 0}
 	}
-	return ScoredGrp{Score: len(imgItems), ImgItems: imgItems}
+	score, features := scorer.Score(&ImgGroup{ImgItems: imgItems, LP: lpURL})
+	log.WithFields(log.Fields{
+		"score":    score,
+		"features": features,
+	}).Debug("Score image group")
+	return ScoredGrp{Score: score, ImgItems: imgItems}
 }
 
 //          c--...--img
@@ -332,11 +377,22 @@ func extractImg(n *html.Node, lpURL *url.URL) []ImgItem {
 	}
 	var imgItems []ImgItem
 	for curr := n.FirstChild; curr != nil; curr = curr.NextSibling {
-		for curr.Data != "img" {
-			curr = curr.FirstChild
+		// images may be wrapped, eg: background images are appended to their elements
+		leaf := curr
+		for leaf != nil && leaf.Data != "img" {
+			leaf = leaf.FirstChild
+		}
+		if leaf == nil {
+			continue
+		}
+		img, err := normalizeImg(leaf, lpURL)
+		if err != nil {
+			continue
 		}
-		img, err := normalizeImg(curr, lpURL)
-		if err != nil || filterImg(img) {
+		if fPicProbe {
+			fillImgSize(imgProber, &img)
+		}
+		if filterImg(img) {
 			continue
 		}
 		imgItems = append(imgItems, img)
@@ -390,14 +446,21 @@ func extractImg(n *html.Node, lpURL *url.URL) []ImgItem {
 }
 
 func normalizeImg(n *html.Node, lpURL *url.URL) (ImgItem, error) {
-	var imgSrc, lazyImgSrc string
-	var img ImgItem
+	var imgSrc, srcset, lazyImgSrc, lazySrcset, pictureSrcset string
+	var attrWidth, attrHeight float64
+	img := ImgItem{Origin: OriginImg}
 	for _, attr := range n.Attr {
 		switch attr.Key {
-		case "data-original", "data-src": // suppose they don't coexist
-			lazyImgSrc = attr.Val
 		case "src":
 			imgSrc = attr.Val
+		case "srcset":
+			srcset = attr.Val
+		case pictureAttr:
+			pictureSrcset = attr.Val
+		case "width":
+			attrWidth, _ = strconv.ParseFloat(attr.Val, 64)
+		case "height":
+			attrHeight, _ = strconv.ParseFloat(attr.Val, 64)
 		case "prim-top", "prim_top":
 			img.Top, _ = strconv.ParseFloat(attr.Val, 64)
 		case "prim-left", "prim_left":
@@ -406,20 +469,54 @@ func normalizeImg(n *html.Node, lpURL *url.URL) (ImgItem, error) {
 			img.Width, _ = strconv.ParseFloat(attr.Val, 64)
 		case "prim-height", "prim_height":
 			img.Height, _ = strconv.ParseFloat(attr.Val, 64)
+		case originAttr:
+			img.Origin = attr.Val
+		case depthAttr:
+			img.Depth, _ = strconv.Atoi(attr.Val)
+		}
+	}
+	// the first lazy attribute wins if they coexist
+	for _, name := range lazyAttrs {
+		val, ok := getAttr(n, name)
+		if !ok || strings.TrimSpace(val) == "" {
+			continue
+		}
+		if isSrcsetAttr(name) {
+			if lazySrcset == "" {
+				lazySrcset = val
+			}
+		} else if lazyImgSrc == "" {
+			lazyImgSrc = val
 		}
 	}
 
-	if lazyImgSrc != "" && imgSrc != lazyImgSrc {
-		// image not loaded, we may get wrong size
+	if (lazyImgSrc != "" && imgSrc != lazyImgSrc) || (lazySrcset != "" && srcset != lazySrcset) {
+		// image not loaded, size of placeholder is wrong
 		log.WithFields(log.Fields{
 			"lazyImgSrc": lazyImgSrc,
+			"lazySrcset": lazySrcset,
 			"imgSrc":     imgSrc,
 			"width":      img.Width,
 			"height":     img.Height,
-		}).Debug("Ignore image which was not loaded")
-		return img, errors.New("ignore image which was not loaded")
+		}).Debug("Image was not loaded, use size of attributes")
+		img.Width, img.Height = attrWidth, attrHeight
+		if lazyImgSrc != "" {
+			imgSrc = lazyImgSrc
+		}
+		if lazySrcset != "" {
+			srcset = lazySrcset
+		}
 	}
-	if imgSrc == "" {
+	// the loaded one may be smaller, but its size has the same ratio
+	var candidates []ImgCandidate
+	for _, set := range []string{srcset, pictureSrcset} {
+		candidates = append(candidates, parseSrcset(set)...)
+	}
+	if best, ok := bestCandidate(candidates); ok {
+		imgSrc = best.URL
+		img.SrcWidth = best.Width
+	}
+	if imgSrc == "" || strings.HasPrefix(imgSrc, "data:") {
 		var buf bytes.Buffer
 		html.Render(&buf, n)
 		log.WithFields(log.Fields{
@@ -439,7 +536,9 @@ func normalizeImg(n *html.Node, lpURL *url.URL) (ImgItem, error) {
 	}
 
 	img.Src = lpURL.ResolveReference(imgURL).String()
-	img.Ratio = img.Width / img.Height
+	if img.Height > 0 {
+		img.Ratio = img.Width / img.Height
+	}
 	log.WithField("imgItem", img).Debug("Normalize image")
 
 	return img, nil
@@ -0,0 +1,316 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif" // decoders for image.DecodeConfig
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	log "github.com/Sirupsen/logrus"
+	_ "golang.org/x/image/webp"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// probeHeaderSize is enough for headers of most images, the body is read
+	// only until the size is decoded
+	probeHeaderSize = 256 * 1024
+	// probeImageSize is the max size of image downloaded for hashing
+	probeImageSize = 20 * 1024 * 1024
+	// probeMemEntries bound the in-memory cache, it's reset when full
+	probeMemEntries = 100000
+)
+
+// ImgSize is the natural size of image
+type ImgSize struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// ImgProber fetch header bytes of images to get their natural size, it's used
+// when html has no size marked by crawl. It also download images for perceptual
+// hash. Results are cached on disk by url.
+type ImgProber struct {
+	client   *http.Client
+	timeout  time.Duration
+	cacheDir string // empty means no disk cache
+	sem      chan struct{}
+
+	mu      sync.Mutex
+	entries map[string]*probeEntry // kind and url => result, failures included
+}
+
+type probeEntry struct {
+	done chan struct{} // closed when probed
+	data []byte        // result in json, as it's cached on disk
+	err  error
+}
+
+func newImgProber(parallel int, timeout time.Duration, cacheDir string) (*ImgProber, error) {
+	if parallel <= 0 {
+		return nil, fmt.Errorf("probe parallel should be positive")
+	}
+	if cacheDir != "" {
+		if err := os.MkdirAll(cacheDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &ImgProber{
+		client:   &http.Client{},
+		timeout:  timeout,
+		cacheDir: cacheDir,
+		sem:      make(chan struct{}, parallel),
+		entries:  make(map[string]*probeEntry),
+	}, nil
+}
+
+// Size return natural size of image, the same url is probed only once
+func (p *ImgProber) Size(src string) (ImgSize, error) {
+	var size ImgSize
+	err := p.probe("size", src, &size, func(r io.Reader) (interface{}, error) {
+		conf, format, err := image.DecodeConfig(r)
+		if err != nil {
+			return nil, err
+		}
+		if conf.Width <= 0 || conf.Height <= 0 {
+			return nil, fmt.Errorf("invalid %s size %dx%d", format, conf.Width, conf.Height)
+		}
+		return ImgSize{Width: conf.Width, Height: conf.Height}, nil
+	})
+	return size, err
+}
+
+// Prefetch probe sizes of images concurrently, so they are cached when used one by one
+func (p *ImgProber) Prefetch(srcs []string) {
+	p.each(srcs, func(src string) { p.Size(src) })
+}
+
+// each call f for every src concurrently, fetching is limited by the prober
+func (p *ImgProber) each(srcs []string, f func(src string)) {
+	var g errgroup.Group
+	for _, src := range srcs {
+		src := src
+		g.Go(func() error {
+			f(src)
+			return nil
+		})
+	}
+	g.Wait()
+}
+
+// probe decode image of src into val, kind is the type of result, eg: size or
+// algorithm of hash. The same kind of url is probed only once.
+func (p *ImgProber) probe(kind, src string, val interface{}, decode func(r io.Reader) (interface{}, error)) error {
+	key := kind + " " + src
+	p.mu.Lock()
+	e, ok := p.entries[key]
+	if !ok {
+		if len(p.entries) >= probeMemEntries {
+			p.entries = make(map[string]*probeEntry)
+		}
+		e = &probeEntry{done: make(chan struct{})}
+		p.entries[key] = e
+	}
+	p.mu.Unlock()
+	if !ok {
+		e.data, e.err = p.load(kind, src, decode)
+		close(e.done)
+	}
+	<-e.done
+	if e.err != nil {
+		return e.err
+	}
+	return json.Unmarshal(e.data, val)
+}
+
+// observeProbe count result of probing, hashes are counted by algorithm
+func observeProbe(kind, result string) {
+	if kind == "size" {
+		metricImgProbes.WithLabelValues(result).Inc()
+		return
+	}
+	metricImgHashes.WithLabelValues(kind, result).Inc()
+}
+
+func (p *ImgProber) load(kind, src string, decode func(r io.Reader) (interface{}, error)) ([]byte, error) {
+	if data, ok := p.readCache(kind, src); ok {
+		observeProbe(kind, "cache")
+		return data, nil
+	}
+
+	// only header is needed for size
+	limit := int64(probeImageSize)
+	if kind == "size" {
+		limit = probeHeaderSize
+	}
+	p.sem <- struct{}{}
+	val, err := p.fetch(src, limit, decode)
+	<-p.sem
+	if err != nil {
+		observeProbe(kind, "failed")
+		log.WithFields(log.Fields{
+			"kind": kind,
+			"src":  src,
+			"err":  err,
+		}).Info("Failed to probe image")
+		return nil, err
+	}
+	observeProbe(kind, "fetched")
+	data, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	p.writeCache(kind, src, data)
+	return data, nil
+}
+
+func (p *ImgProber) fetch(src string, limit int64, decode func(r io.Reader) (interface{}, error)) (interface{}, error) {
+	u, err := url.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+
+	ctx := context.Background()
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return nil, err
+	}
+	if limit < probeImageSize {
+		// servers may ignore range and send the whole image
+		req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", limit-1))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return decode(bufio.NewReader(io.LimitReader(resp.Body, limit)))
+}
+
+// cachePath shard cache files by the first byte of hash, each kind is in its sub dir
+func (p *ImgProber) cachePath(kind, src string) string {
+	sum := sha1.Sum([]byte(src))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(p.cacheDir, kind, name[:2], name+".json")
+}
+
+// readCache return the cached json object without its url, eg: {"url":"a.jpg","width":1,"height":1}
+func (p *ImgProber) readCache(kind, src string) ([]byte, bool) {
+	if p.cacheDir == "" {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(p.cachePath(kind, src))
+	if err != nil {
+		return nil, false
+	}
+	var item map[string]json.RawMessage
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, false
+	}
+	// url is checked in case of hash collision
+	var url string
+	if err := json.Unmarshal(item["url"], &url); err != nil || url != src {
+		return nil, false
+	}
+	delete(item, "url")
+	if data, err = json.Marshal(item); err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// writeCache add url to json object of val, and write it to cache file
+func (p *ImgProber) writeCache(kind, src string, val []byte) {
+	if p.cacheDir == "" {
+		return
+	}
+	path := p.cachePath(kind, src)
+	var item map[string]interface{}
+	err := json.Unmarshal(val, &item)
+	if err == nil {
+		item["url"] = src
+		val, err = json.Marshal(item)
+	}
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+	}
+	if err == nil {
+		// written to temp file first, so concurrent readers never see partial file
+		tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+		if err = ioutil.WriteFile(tmp, val, 0644); err == nil {
+			err = os.Rename(tmp, path)
+		}
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"src":  src,
+			"path": path,
+			"err":  err,
+		}).Warn("Failed to write image probe cache")
+	}
+}
+
+// prefetchImgSizes probe images without size in document concurrently
+func prefetchImgSizes(p *ImgProber, doc *goquery.Document, lpURL *url.URL) {
+	var srcs []string
+	uniq := make(map[string]bool)
+	doc.Find("img").Each(func(_ int, sel *goquery.Selection) {
+		img, err := normalizeImg(sel.Nodes[0], lpURL)
+		if err != nil || (img.Width > 0 && img.Height > 0) || uniq[img.Src] {
+			return
+		}
+		uniq[img.Src] = true
+		srcs = append(srcs, img.Src)
+	})
+	if len(srcs) > 0 {
+		p.Prefetch(srcs)
+	}
+}
+
+// fillImgSize set missing size of image by its natural size, if only one of width
+// and height is known, the other one is scaled by natural ratio
+func fillImgSize(p *ImgProber, img *ImgItem) {
+	if img.Width > 0 && img.Height > 0 {
+		return
+	}
+	size, err := p.Size(img.Src)
+	if err != nil {
+		return
+	}
+	w, h := float64(size.Width), float64(size.Height)
+	switch {
+	case img.Width > 0:
+		img.Height = img.Width * h / w
+	case img.Height > 0:
+		img.Width = img.Height * w / h
+	default:
+		img.Width, img.Height = w, h
+	}
+	img.Ratio = img.Width / img.Height
+}
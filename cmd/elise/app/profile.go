@@ -0,0 +1,235 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// Profile emulate a device for pages of one data file, it's applied before navigate
+type Profile struct {
+	UserAgent string
+	Viewport  Viewport
+	Headers   map[string]string
+	Cookies   []*http.Cookie // domain is the host of target url when empty
+	Locale    string         // eg: zh-CN, sent as Accept-Language too
+	Timezone  string         // IANA name, eg: Asia/Shanghai, only supported by chrome
+}
+
+// Viewport is the size of window in css pixels, zero means the driver default
+type Viewport struct {
+	Width  int
+	Height int
+	Scale  float64 // device pixel ratio
+	Mobile bool
+}
+
+// emulator is implemented by pages which can emulate device before navigate
+type emulator interface {
+	Emulate(profile *Profile, url string) error
+}
+
+const (
+	uaIPhone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 15_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/15.0 Mobile/15E148 Safari/604.1"
+	uaIPad    = "Mozilla/5.0 (iPad; CPU OS 15_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/15.0 Mobile/15E148 Safari/604.1"
+	uaAndroid = "Mozilla/5.0 (Linux; Android 11; Pixel 5) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/90.0.4430.91 Mobile Safari/537.36"
+	uaDesktop = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/90.0.4430.93 Safari/537.36"
+)
+
+// devicePresets can be selected by 'device', other settings override the preset
+var devicePresets = map[string]Profile{
+	"iphone":  {UserAgent: uaIPhone, Viewport: Viewport{Width: 390, Height: 844, Scale: 3, Mobile: true}},
+	"ipad":    {UserAgent: uaIPad, Viewport: Viewport{Width: 820, Height: 1180, Scale: 2, Mobile: true}},
+	"android": {UserAgent: uaAndroid, Viewport: Viewport{Width: 393, Height: 851, Scale: 2.75, Mobile: true}},
+	"desktop": {UserAgent: uaDesktop, Viewport: Viewport{Width: 1366, Height: 768, Scale: 1}},
+}
+
+func deviceNames() []string {
+	var names []string
+	for name := range devicePresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseProfile read device settings of data file, return nil if nothing is set
+//
+//	device: iphone
+//	user_agent: Mozilla/5.0 ...
+//	viewport: 375x667 # or {width: 375, height: 667, scale: 2, mobile: true}
+//	headers: {Referer: http://m.163.com/}
+//	cookies: {uid: "123"} # or [{name: uid, value: "123", domain: .163.com, path: /}]
+//	locale: zh-CN
+//	timezone: Asia/Shanghai
+func parseProfile(conf map[string]interface{}) (*Profile, error) {
+	var p *Profile
+	if val, ok := conf["device"]; ok {
+		name, _ := val.(string)
+		preset, ok := devicePresets[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown device %v, should be one of %v", val, deviceNames())
+		}
+		p = &preset
+	}
+	for _, key := range []string{"user_agent", "viewport", "headers", "cookies", "locale", "timezone"} {
+		val, ok := conf[key]
+		if !ok {
+			continue
+		}
+		if p == nil {
+			p = &Profile{}
+		}
+		var err error
+		switch key {
+		case "user_agent":
+			p.UserAgent, err = cast.ToStringE(val)
+		case "viewport":
+			p.Viewport, err = parseViewport(val)
+		case "headers":
+			p.Headers, err = cast.ToStringMapStringE(val)
+		case "cookies":
+			p.Cookies, err = parseCookies(val)
+		case "locale":
+			p.Locale, err = cast.ToStringE(val)
+		case "timezone":
+			p.Timezone, err = cast.ToStringE(val)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s conf: %v", key, err)
+		}
+	}
+	return p, nil
+}
+
+func parseViewport(val interface{}) (Viewport, error) {
+	var v Viewport
+	if size, ok := val.(string); ok {
+		if _, err := fmt.Sscanf(size, "%dx%d", &v.Width, &v.Height); err != nil {
+			return v, fmt.Errorf("size should be like 375x667")
+		}
+		return v, nil
+	}
+	conf, err := cast.ToStringMapE(val)
+	if err != nil {
+		return v, err
+	}
+	for key, val := range conf {
+		switch key {
+		case "width":
+			v.Width, err = cast.ToIntE(val)
+		case "height":
+			v.Height, err = cast.ToIntE(val)
+		case "scale":
+			v.Scale, err = cast.ToFloat64E(val)
+		case "mobile":
+			v.Mobile, err = cast.ToBoolE(val)
+		default:
+			err = fmt.Errorf("unknown key %q", key)
+		}
+		if err != nil {
+			return v, err
+		}
+	}
+	if v.Width <= 0 || v.Height <= 0 {
+		return v, fmt.Errorf("width and height should be positive")
+	}
+	return v, nil
+}
+
+func parseCookies(val interface{}) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+	if list, ok := val.([]interface{}); ok {
+		for _, v := range list {
+			conf, err := cast.ToStringMapStringE(v)
+			if err != nil {
+				return nil, err
+			}
+			c := &http.Cookie{
+				Name:   conf["name"],
+				Value:  conf["value"],
+				Domain: conf["domain"],
+				Path:   conf["path"],
+			}
+			if c.Name == "" {
+				return nil, fmt.Errorf("name of cookie is empty")
+			}
+			cookies = append(cookies, c)
+		}
+		return cookies, nil
+	}
+	conf, err := cast.ToStringMapStringE(val)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range conf {
+		cookies = append(cookies, &http.Cookie{Name: name, Value: value})
+	}
+	sort.Slice(cookies, func(i, j int) bool { return cookies[i].Name < cookies[j].Name })
+	return cookies, nil
+}
+
+// CookiesFor return cookies with domain and path filled for target url
+func (p *Profile) CookiesFor(rawURL string) []*http.Cookie {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return p.Cookies
+	}
+	var cookies []*http.Cookie
+	for _, c := range p.Cookies {
+		cookie := *c
+		if cookie.Domain == "" {
+			cookie.Domain = u.Hostname()
+		}
+		if cookie.Path == "" {
+			cookie.Path = "/"
+		}
+		cookies = append(cookies, &cookie)
+	}
+	return cookies
+}
+
+// RequestHeaders return extra headers sent with every request, include Accept-Language of locale
+func (p *Profile) RequestHeaders() map[string]string {
+	headers := make(map[string]string)
+	for k, v := range p.Headers {
+		headers[k] = v
+	}
+	if lang := p.AcceptLanguage(); lang != "" && !hasHeader(headers, "Accept-Language") {
+		headers["Accept-Language"] = lang
+	}
+	return headers
+}
+
+// AcceptLanguage return "zh-CN,zh;q=0.9" for "zh-CN"
+func (p *Profile) AcceptLanguage() string {
+	if p.Locale == "" {
+		return ""
+	}
+	if i := strings.IndexAny(p.Locale, "-_"); i > 0 {
+		return p.Locale + "," + p.Locale[:i] + ";q=0.9"
+	}
+	return p.Locale
+}
+
+func hasHeader(headers map[string]string, name string) bool {
+	for k := range headers {
+		if strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// emulate apply profile to page before navigate
+func emulate(page Page, profile *Profile, url string) error {
+	p, ok := page.(emulator)
+	if !ok {
+		return fmt.Errorf("driver can't emulate device")
+	}
+	return p.Emulate(profile, url)
+}
@@ -0,0 +1,196 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+const summaryFile = "crawl_summary.json"
+
+// FileStats is a snapshot of counters of one data file
+type FileStats struct {
+	File       string  `json:"file"`
+	Lines      uint64  `json:"lines"` // lines in data file when started
+	Read       uint64  `json:"read"`
+	Dispatched uint64  `json:"dispatched"` // seeds and followed links
+	Queued     uint64  `json:"queued"`     // waiting for host slot or retry backoff
+	Running    uint64  `json:"running"`
+	Completed  uint64  `json:"completed"` // empty results included
+	Empty      uint64  `json:"empty"`
+	Retried    uint64  `json:"retried"`
+	Failed     uint64  `json:"failed"`
+	TimedOut   uint64  `json:"timed_out"` // failed by timeout, included in failed
+	Abandoned  uint64  `json:"abandoned"` // queued or running when shutting down
+	Skipped    uint64  `json:"skipped"`
+	Duplicated uint64  `json:"duplicated"`
+	Invalid    uint64  `json:"invalid"`
+	Rate       float64 `json:"urls_per_second"`
+	ETA        float64 `json:"eta_seconds,omitempty"` // 0 when done or unknown
+	Elapsed    float64 `json:"elapsed_seconds"`
+	Done       bool    `json:"done"`
+}
+
+// Stats read counters of data file, they may be updated at the same time
+func (fi *FileInfo) Stats() FileStats {
+	s := FileStats{
+		File:       fi.Filename,
+		Lines:      fi.Lines,
+		Read:       atomic.LoadUint64(&fi.Line),
+		Dispatched: atomic.LoadUint64(&fi.Dispatched),
+		Running:    atomic.LoadUint64(&fi.Running),
+		Completed:  atomic.LoadUint64(&fi.Completed),
+		Empty:      atomic.LoadUint64(&fi.Empty),
+		Retried:    atomic.LoadUint64(&fi.Retried),
+		Failed:     atomic.LoadUint64(&fi.Failed),
+		TimedOut:   atomic.LoadUint64(&fi.TimedOut),
+		Skipped:    atomic.LoadUint64(&fi.Skipped),
+		Duplicated: atomic.LoadUint64(&fi.Duplicated),
+		Invalid:    atomic.LoadUint64(&fi.Invalid),
+	}
+	elapsed := time.Since(fi.Start)
+	if end := atomic.LoadInt64(&fi.End); end > 0 {
+		elapsed = time.Unix(0, end).Sub(fi.Start)
+		s.Done = true
+	}
+	s.Elapsed = elapsed.Seconds()
+
+	// results of running urls are dropped when aborted
+	var pending uint64
+	if s.Dispatched > s.Completed+s.Failed {
+		pending = s.Dispatched - s.Completed - s.Failed
+	}
+	if s.Done {
+		s.Abandoned = pending
+	} else if pending > s.Running {
+		s.Queued = pending - s.Running
+	}
+	if elapsed > 0 {
+		s.Rate = float64(s.Completed+s.Failed) / elapsed.Seconds()
+	}
+	// links to follow are unknown, so it's the ETA of seeds
+	if !s.Done && s.Rate > 0 {
+		remain := s.Queued + s.Running
+		if s.Lines > s.Read {
+			remain += s.Lines - s.Read
+		}
+		s.ETA = float64(remain) / s.Rate
+	}
+	return s
+}
+
+// countLines count lines of data file for ETA
+func countLines(path string) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var lines uint64
+	var last byte = '\n'
+	r := bufio.NewReader(file)
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			lines += uint64(bytes.Count(buf[:n], []byte{'\n'}))
+			last = buf[n-1]
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	if last != '\n' {
+		lines++
+	}
+	return lines, nil
+}
+
+// reportProgress print stats of data files not done to stderr every interval until stop is closed
+func reportProgress(run *crawlRun, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		var stats []FileStats
+		for _, fi := range run.fileList() {
+			if s := fi.Stats(); !s.Done {
+				stats = append(stats, s)
+			}
+		}
+		if len(stats) == 0 {
+			continue
+		}
+		w := tabwriter.NewWriter(os.Stderr, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(w, "[%s] PROGRESS\tREAD\tQUEUED\tRUNNING\tCOMPLETED\tEMPTY\tRETRIED\tFAILED\tURL/S\tETA\n",
+			time.Now().Format("15:04:05"))
+		for _, s := range stats {
+			read := fmt.Sprint(s.Read)
+			if s.Lines > 0 {
+				read = fmt.Sprintf("%d/%d", s.Read, s.Lines)
+			}
+			eta := "-"
+			if s.ETA > 0 {
+				eta = time.Duration(s.ETA * float64(time.Second)).Truncate(time.Second).String()
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%.2f\t%s\n", s.File, read, s.Queued,
+				s.Running, s.Completed, s.Empty, s.Retried, s.Failed, s.Rate, eta)
+		}
+		w.Flush()
+	}
+}
+
+// printSummary print what was completed and abandoned for each data file
+func printSummary(files []*FileInfo) {
+	w := tabwriter.NewWriter(os.Stderr, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tDISPATCHED\tCOMPLETED\tEMPTY\tRETRIED\tFAILED\tTIMEOUT\tABANDONED\tSKIPPED\tDUPLICATED\tINVALID\tELAPSED")
+	for _, fi := range files {
+		s := fi.Stats()
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%v\n", s.File, s.Dispatched, s.Completed,
+			s.Empty, s.Retried, s.Failed, s.TimedOut, s.Abandoned, s.Skipped, s.Duplicated, s.Invalid,
+			time.Duration(s.Elapsed*float64(time.Second)).Truncate(time.Millisecond))
+	}
+	w.Flush()
+}
+
+type crawlSummary struct {
+	Start       time.Time   `json:"start"`
+	End         time.Time   `json:"end"`
+	Elapsed     float64     `json:"elapsed_seconds"`
+	Interrupted bool        `json:"interrupted"`
+	Files       []FileStats `json:"files"`
+}
+
+// writeSummary write stats of all data files to output dir as json
+func writeSummary(files []*FileInfo, start time.Time, interrupted bool) error {
+	summary := crawlSummary{
+		Start:       start,
+		End:         time.Now(),
+		Elapsed:     time.Since(start).Seconds(),
+		Interrupted: interrupted,
+		Files:       []FileStats{},
+	}
+	for _, fi := range files {
+		summary.Files = append(summary.Files, fi.Stats())
+	}
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(fEliseOutputDir, summaryFile), append(data, '\n'), 0666)
+}
@@ -0,0 +1,179 @@
+package app
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/spf13/cast"
+)
+
+// ProxyPool rotate proxies across workers, a proxy failed to navigate
+// MaxFailures times in a row is unhealthy until Cooldown passes
+type ProxyPool struct {
+	MaxFailures int
+	Cooldown    time.Duration
+
+	mu      sync.Mutex
+	proxies []*proxyState
+	next    int
+}
+
+type proxyState struct {
+	url      *url.URL
+	failures int       // navigate failures in a row
+	until    time.Time // unhealthy until
+}
+
+func newProxyPool(urls []string) (*ProxyPool, error) {
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no proxy")
+	}
+	p := &ProxyPool{MaxFailures: 3, Cooldown: 5 * time.Minute}
+	for _, s := range urls {
+		u, err := parseProxyURL(s)
+		if err != nil {
+			return nil, err
+		}
+		p.proxies = append(p.proxies, &proxyState{url: u})
+	}
+	return p, nil
+}
+
+// hasUserInfo return true if any proxy has credentials, nil pool has no proxy
+func (p *ProxyPool) hasUserInfo() bool {
+	if p == nil {
+		return false
+	}
+	for _, s := range p.proxies {
+		if s.url.User != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// parseProxyURL accept http, https and socks5 proxies, "host:port" is a http proxy
+func parseProxyURL(s string) (*url.URL, error) {
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("proxy %q should be http, https or socks5", s)
+	}
+	if u.Hostname() == "" || u.Port() == "" {
+		return nil, fmt.Errorf("proxy %q should have host and port", s)
+	}
+	return u, nil
+}
+
+// parseProxyPool read 'proxy' conf of data file, nil means no proxy
+//
+//	proxy: socks5://127.0.0.1:1080 # or a list of proxies, or false to ignore --proxy
+//	proxy:
+//	  urls: [http://10.0.0.1:8080, http://10.0.0.2:8080]
+//	  max_failures: 3
+//	  cooldown: 5m
+func parseProxyPool(val interface{}) (*ProxyPool, error) {
+	switch val := val.(type) {
+	case bool:
+		if val {
+			return nil, fmt.Errorf("proxy should be url, list of urls or false")
+		}
+		return nil, nil
+	case string:
+		return newProxyPool([]string{val})
+	case []interface{}:
+		urls, err := cast.ToStringSliceE(val)
+		if err != nil {
+			return nil, err
+		}
+		return newProxyPool(urls)
+	}
+
+	conf, err := cast.ToStringMapE(val)
+	if err != nil {
+		return nil, err
+	}
+	urls, err := cast.ToStringSliceE(conf["urls"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy conf \"urls\": %v", err)
+	}
+	p, err := newProxyPool(urls)
+	if err != nil {
+		return nil, err
+	}
+	for key, v := range conf {
+		switch key {
+		case "urls":
+		case "max_failures":
+			p.MaxFailures, err = cast.ToIntE(v)
+		case "cooldown":
+			p.Cooldown, err = cast.ToDurationE(v)
+		default:
+			return nil, fmt.Errorf("unknown proxy conf %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy conf %q: %v", key, err)
+		}
+	}
+	if p.MaxFailures < 1 {
+		return nil, fmt.Errorf("max_failures should be at least 1")
+	}
+	return p, nil
+}
+
+// Pick return the next healthy proxy, the one recovering first if all are unhealthy
+func (p *ProxyPool) Pick() *url.URL {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	var earliest *proxyState
+	for i := 0; i < len(p.proxies); i++ {
+		s := p.proxies[p.next]
+		p.next = (p.next + 1) % len(p.proxies)
+		if !now.Before(s.until) {
+			return s.url
+		}
+		if earliest == nil || s.until.Before(earliest.until) {
+			earliest = s
+		}
+	}
+	return earliest.url
+}
+
+// Report record result of navigating by proxy, only navigate errors are counted,
+// since the page has been loaded for the others
+func (p *ProxyPool) Report(proxy *url.URL, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, s := range p.proxies {
+		if s.url != proxy {
+			continue
+		}
+		kind := errKindOf(err)
+		if err == nil || (kind != ErrNavigate && kind != ErrNavigateTimeout) {
+			s.failures = 0
+			return
+		}
+		s.failures++
+		if s.failures >= p.MaxFailures {
+			s.failures = 0
+			s.until = time.Now().Add(p.Cooldown)
+			log.WithFields(log.Fields{
+				"proxy": proxy.Redacted(),
+				"until": s.until,
+			}).Warn("Proxy is unhealthy")
+		}
+		return
+	}
+}
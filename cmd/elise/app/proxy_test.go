@@ -0,0 +1,147 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newStandInProxy answer requests for any host like a forward proxy, hosts requested are recorded
+func newStandInProxy(t *testing.T) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var hosts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// requests to proxy have absolute url
+		if !r.URL.IsAbs() {
+			http.Error(w, "not a proxy request", http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		hosts = append(hosts, r.URL.Host)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, "<html><head><title>proxied</title></head><body><p>via proxy</p></body></html>")
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), hosts...)
+	}
+}
+
+func TestHTTPDriverProxy(t *testing.T) {
+	srv, hosts := newStandInProxy(t)
+	proxy, err := parseProxyURL(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := newHTTPDriver()
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Stop()
+	page, err := newPage(d, proxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer page.Destroy()
+	// the host doesn't exist, so the page can only come from proxy
+	if err := page.Navigate("http://elise.invalid/page"); err != nil {
+		t.Fatal(err)
+	}
+	html, err := page.HTML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(html, "via proxy") {
+		t.Errorf("html = %q, want page from proxy", html)
+	}
+	if got := hosts(); len(got) != 1 || got[0] != "elise.invalid" {
+		t.Errorf("hosts requested by proxy = %v, want [elise.invalid]", got)
+	}
+}
+
+func TestHTTPDriverProxyStop(t *testing.T) {
+	d := newHTTPDriver()
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// pages are created by worker while shutting down
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			proxy := &url.URL{Scheme: "http", Host: fmt.Sprintf("127.0.0.1:%d", 8080+i)}
+			for j := 0; j < 100; j++ {
+				newPage(d, proxy)
+			}
+		}(i)
+	}
+	for i := 0; i < 100; i++ {
+		d.Stop()
+	}
+	wg.Wait()
+}
+
+func TestProxyPoolHealth(t *testing.T) {
+	p, err := newProxyPool([]string{"127.0.0.1:8080", "socks5://127.0.0.1:1080"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.MaxFailures = 2
+	p.Cooldown = 100 * time.Millisecond
+	a, b := p.Pick(), p.Pick()
+	if a.String() != "http://127.0.0.1:8080" || b.String() != "socks5://127.0.0.1:1080" {
+		t.Fatalf("picked %v and %v, want proxies in turn", a, b)
+	}
+
+	navErr := newParseError(ErrNavigate, errors.New("connection refused"))
+	p.Report(a, navErr)
+	// errors after page loaded are not counted, and reset failures in a row
+	p.Report(a, newParseError(ErrScript, errors.New("undefined")))
+	p.Report(a, navErr)
+	if got := []*url.URL{p.Pick(), p.Pick()}; got[0] != a || got[1] != b {
+		t.Fatalf("picked %v, want both proxies healthy", got)
+	}
+
+	p.Report(a, newParseError(ErrNavigateTimeout, errors.New("timeout")))
+	for i := 0; i < 4; i++ {
+		if got := p.Pick(); got != b {
+			t.Fatalf("picked %v, want %v only while %v is unhealthy", got, b, a)
+		}
+	}
+
+	time.Sleep(p.Cooldown)
+	picked := map[*url.URL]bool{p.Pick(): true, p.Pick(): true}
+	if !picked[a] || !picked[b] {
+		t.Errorf("picked %v, want %v back after cooldown", picked, a)
+	}
+}
+
+func TestProxyPoolAllUnhealthy(t *testing.T) {
+	p, err := newProxyPool([]string{"127.0.0.1:8080", "127.0.0.1:8081"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.MaxFailures = 1
+	navErr := newParseError(ErrNavigate, errors.New("connection refused"))
+	a := p.Pick()
+	p.Report(a, navErr)
+	time.Sleep(10 * time.Millisecond)
+	b := p.Pick()
+	p.Report(b, navErr)
+	// the one recovering first is used
+	if got := p.Pick(); got != a {
+		t.Errorf("picked %v, want %v", got, a)
+	}
+}
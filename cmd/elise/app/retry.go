@@ -0,0 +1,185 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// ErrKind classify why parsing url failed, every kind has its own retry decision
+type ErrKind string
+
+const (
+	ErrNavigateTimeout ErrKind = "navigate_timeout"
+	ErrNavigate        ErrKind = "navigate_error"
+	ErrScriptTimeout   ErrKind = "script_timeout"
+	ErrScript          ErrKind = "script_error"
+	ErrWaitTimeout     ErrKind = "wait_timeout"
+	ErrURLTimeout      ErrKind = "url_timeout"
+	ErrDriverCrash     ErrKind = "driver_crash"
+	ErrEmptyResult     ErrKind = "empty_result"
+)
+
+var errKinds = []ErrKind{ErrNavigateTimeout, ErrNavigate, ErrScriptTimeout, ErrScript, ErrWaitTimeout,
+	ErrURLTimeout, ErrDriverCrash, ErrEmptyResult}
+
+type parseError struct {
+	Kind ErrKind
+	Err  error
+}
+
+func (e *parseError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Kind, e.Err)
+}
+
+func newParseError(kind ErrKind, err error) *parseError {
+	return &parseError{Kind: kind, Err: err}
+}
+
+// errKindOf return driver_crash for errors not classified
+func errKindOf(err error) ErrKind {
+	var pe *parseError
+	if errors.As(err, &pe) {
+		return pe.Kind
+	}
+	return ErrDriverCrash
+}
+
+// isTimeoutKind return true for kinds of timeout, they are counted as their own outcome
+func isTimeoutKind(kind ErrKind) bool {
+	switch kind {
+	case ErrNavigateTimeout, ErrScriptTimeout, ErrWaitTimeout, ErrURLTimeout:
+		return true
+	}
+	return false
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	// webdriver only give us message
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "timeout") || strings.Contains(msg, "timed out")
+}
+
+// RetryPolicy decide whether and when a failed url is retried
+type RetryPolicy struct {
+	MaxAttempts int           // include the first attempt
+	Backoff     time.Duration // delay before the first retry, doubled for each retry
+	MaxBackoff  time.Duration
+	Jitter      float64 // delay is randomized by +-Jitter*delay
+	RetryOn     map[ErrKind]bool
+}
+
+// defaultRetryPolicy retry once after 10 seconds for all errors except empty result,
+// timeouts included, the driver is restarted before retrying url_timeout
+func defaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 2,
+		Backoff:     10 * time.Second,
+		MaxBackoff:  5 * time.Minute,
+		RetryOn: map[ErrKind]bool{
+			ErrNavigateTimeout: true,
+			ErrNavigate:        true,
+			ErrScriptTimeout:   true,
+			ErrScript:          true,
+			ErrWaitTimeout:     true,
+			ErrURLTimeout:      true,
+			ErrDriverCrash:     true,
+			ErrEmptyResult:     false,
+		},
+	}
+}
+
+// parseRetryPolicy override default policy with 'retry' conf of data file
+//
+//	retry:
+//	  max_attempts: 3
+//	  backoff: 10s
+//	  max_backoff: 2m
+//	  jitter: 0.2
+//	  retry_on:
+//	    script_error: false
+//	    empty_result: true
+func parseRetryPolicy(val interface{}) (RetryPolicy, error) {
+	p := defaultRetryPolicy()
+	conf, err := cast.ToStringMapE(val)
+	if err != nil {
+		return p, err
+	}
+	for key, v := range conf {
+		switch key {
+		case "max_attempts":
+			p.MaxAttempts, err = cast.ToIntE(v)
+		case "backoff":
+			p.Backoff, err = cast.ToDurationE(v)
+		case "max_backoff":
+			p.MaxBackoff, err = cast.ToDurationE(v)
+		case "jitter":
+			p.Jitter, err = cast.ToFloat64E(v)
+		case "retry_on":
+			var kinds map[string]interface{}
+			if kinds, err = cast.ToStringMapE(v); err != nil {
+				break
+			}
+			for kind, on := range kinds {
+				if !validErrKind(ErrKind(kind)) {
+					return p, fmt.Errorf("unknown error kind %q in retry_on, should be one of %v", kind, errKinds)
+				}
+				if p.RetryOn[ErrKind(kind)], err = cast.ToBoolE(on); err != nil {
+					break
+				}
+			}
+		default:
+			return p, fmt.Errorf("unknown retry conf %q", key)
+		}
+		if err != nil {
+			return p, fmt.Errorf("invalid retry conf %q: %v", key, err)
+		}
+	}
+	if p.MaxAttempts < 1 {
+		return p, fmt.Errorf("max_attempts should be at least 1")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return p, fmt.Errorf("jitter should be in [0, 1]")
+	}
+	return p, nil
+}
+
+func validErrKind(kind ErrKind) bool {
+	for _, k := range errKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// ShouldRetry check whether the url failed at attempt should be retried
+func (p RetryPolicy) ShouldRetry(kind ErrKind, attempt int) bool {
+	return attempt < p.MaxAttempts && p.RetryOn[kind]
+}
+
+// Delay return backoff before the next attempt, attempt start from 1
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	d := float64(p.Backoff) * math.Pow(2, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
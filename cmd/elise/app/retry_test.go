@@ -0,0 +1,168 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsTimeout(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{context.DeadlineExceeded, true},
+		{fmt.Errorf("navigate: %w", context.DeadlineExceeded), true},
+		{&net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}, true},
+		{&net.DNSError{Err: "no such host", Name: "example.com"}, false},
+		// webdriver and chrome only give us message
+		{errors.New("Timed out receiving message from renderer"), true},
+		{errors.New("script timeout"), true},
+		// status of http driver
+		{errors.New("unexpected response status: 504 Gateway Timeout"), true},
+		{errors.New("unexpected response status: 404 Not Found"), false},
+		{errors.New("unexpected response status: 503 Service Unavailable"), false},
+		{context.Canceled, false},
+		{errors.New("ReferenceError: foo is not defined"), false},
+	}
+	for _, tt := range tests {
+		if got := isTimeout(tt.err); got != tt.want {
+			t.Errorf("isTimeout(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestErrKindOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrKind
+	}{
+		{newParseError(ErrNavigate, errors.New("unexpected response status: 404 Not Found")), ErrNavigate},
+		{newParseError(ErrNavigateTimeout, context.DeadlineExceeded), ErrNavigateTimeout},
+		{newParseError(ErrEmptyResult, errors.New("no result")), ErrEmptyResult},
+		{fmt.Errorf("worker: %w", newParseError(ErrScript, errors.New("undefined"))), ErrScript},
+		// errors not classified are from driver
+		{errors.New("connection reset"), ErrDriverCrash},
+	}
+	for _, tt := range tests {
+		if got := errKindOf(tt.err); got != tt.want {
+			t.Errorf("errKindOf(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestParseRetryPolicy(t *testing.T) {
+	custom := defaultRetryPolicy()
+	custom.MaxAttempts = 3
+	custom.Backoff = 2 * time.Second
+	custom.MaxBackoff = time.Minute
+	custom.Jitter = 0.2
+	custom.RetryOn[ErrScript] = false
+	custom.RetryOn[ErrEmptyResult] = true
+
+	tests := []struct {
+		conf interface{}
+		want RetryPolicy
+		err  string
+	}{
+		{map[string]interface{}{}, defaultRetryPolicy(), ""},
+		{
+			map[string]interface{}{
+				"max_attempts": 3,
+				"backoff":      "2s",
+				"max_backoff":  "1m",
+				"jitter":       0.2,
+				"retry_on":     map[string]interface{}{"script_error": false, "empty_result": "true"},
+			},
+			custom,
+			"",
+		},
+		{map[string]interface{}{"attempts": 3}, RetryPolicy{}, `unknown retry conf "attempts"`},
+		{map[string]interface{}{"backoff": "soon"}, RetryPolicy{}, `"backoff"`},
+		{map[string]interface{}{"max_attempts": 0}, RetryPolicy{}, "at least 1"},
+		{map[string]interface{}{"jitter": 1.5}, RetryPolicy{}, "jitter"},
+		{map[string]interface{}{"jitter": -0.1}, RetryPolicy{}, "jitter"},
+		{
+			map[string]interface{}{"retry_on": map[string]interface{}{"http_error": true}},
+			RetryPolicy{},
+			`unknown error kind "http_error"`,
+		},
+		{
+			map[string]interface{}{"retry_on": map[string]interface{}{"navigate_error": "maybe"}},
+			RetryPolicy{},
+			`"retry_on"`,
+		},
+	}
+	for _, tt := range tests {
+		got, err := parseRetryPolicy(tt.conf)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parseRetryPolicy(%v) error = %v, want %q", tt.conf, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseRetryPolicy(%v) = %+v %v, want %+v", tt.conf, got, err, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	p := defaultRetryPolicy()
+	for _, kind := range errKinds {
+		want := kind != ErrEmptyResult
+		if got := p.ShouldRetry(kind, 1); got != want {
+			t.Errorf("default ShouldRetry(%s, 1) = %v, want %v", kind, got, want)
+		}
+		// the default is one retry only
+		if p.ShouldRetry(kind, 2) {
+			t.Errorf("default ShouldRetry(%s, 2) = true, want false", kind)
+		}
+	}
+
+	p.MaxAttempts = 3
+	tests := []struct {
+		kind    ErrKind
+		attempt int
+		want    bool
+	}{
+		{ErrNavigate, 1, true},
+		{ErrNavigate, 2, true},
+		{ErrNavigate, 3, false},
+		{ErrNavigate, 4, false},
+		{ErrEmptyResult, 1, false},
+		{ErrKind("unknown"), 1, false},
+	}
+	for _, tt := range tests {
+		if got := p.ShouldRetry(tt.kind, tt.attempt); got != tt.want {
+			t.Errorf("ShouldRetry(%s, %d) of 3 attempts = %v, want %v", tt.kind, tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	for attempt, want := range []time.Duration{1, 2, 4, 5, 5} {
+		if got := p.Delay(attempt + 1); got != want*time.Second {
+			t.Errorf("Delay(%d) = %v, want %v", attempt+1, got, want*time.Second)
+		}
+	}
+
+	// no max
+	p.MaxBackoff = 0
+	if got := p.Delay(6); got != 32*time.Second {
+		t.Errorf("Delay(6) without max = %v, want 32s", got)
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.Delay(2); got < time.Second || got > 3*time.Second {
+			t.Fatalf("Delay(2) with jitter 0.5 = %v, want in [1s, 3s]", got)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package app
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// HostLimit restrict requests to one host
+type HostLimit struct {
+	Rate           float64 // requests per second, 0 means no limit
+	Burst          int
+	MaxConcurrency int // 0 means no limit
+}
+
+type hostState struct {
+	limit   HostLimit
+	limiter *rate.Limiter
+	running int
+}
+
+// hostStates track running pages and token bucket for every host,
+// shared by all schedulers
+type hostStates struct {
+	mu    sync.Mutex
+	hosts map[string]*hostState
+	wake  chan struct{} // closed and renewed when any host is released
+}
+
+func newHostStates() *hostStates {
+	return &hostStates{
+		hosts: make(map[string]*hostState),
+		wake:  make(chan struct{}),
+	}
+}
+
+// tryAcquire return how long to wait for the next token when host is blocked by rate,
+// 0 when it's blocked by concurrency
+func (hs *hostStates) tryAcquire(host string, limit HostLimit) (time.Duration, bool) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	st, ok := hs.hosts[host]
+	if !ok {
+		st = &hostState{}
+		hs.hosts[host] = st
+	}
+	// the latest conf win when data files have different limit for the same host
+	if !ok || st.limit != limit {
+		st.limit = limit
+		st.limiter = nil
+		if limit.Rate > 0 {
+			burst := limit.Burst
+			if burst < 1 {
+				burst = 1
+			}
+			st.limiter = rate.NewLimiter(rate.Limit(limit.Rate), burst)
+		}
+	}
+
+	if limit.MaxConcurrency > 0 && st.running >= limit.MaxConcurrency {
+		return 0, false
+	}
+	if st.limiter != nil {
+		now := time.Now()
+		if tokens := st.limiter.TokensAt(now); tokens < 1 {
+			return time.Duration((1 - tokens) / limit.Rate * float64(time.Second)), false
+		}
+		st.limiter.AllowN(now, 1)
+	}
+	st.running++
+	return 0, true
+}
+
+// acquire ignore limits, used while draining
+func (hs *hostStates) acquire(host string) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	st, ok := hs.hosts[host]
+	if !ok {
+		st = &hostState{}
+		hs.hosts[host] = st
+	}
+	st.running++
+}
+
+func (hs *hostStates) release(host string) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if st, ok := hs.hosts[host]; ok && st.running > 0 {
+		st.running--
+	}
+	close(hs.wake)
+	hs.wake = make(chan struct{})
+}
+
+func (hs *hostStates) waitChan() <-chan struct{} {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	return hs.wake
+}
+
+// hostScheduler queue urls by host, and dispatch them round-robin between hosts,
+// hosts reaching their limits are skipped, so they won't stall the whole pool
+type hostScheduler struct {
+	ctx      context.Context // limits are ignored after canceled, just drain urls
+	hosts    *hostStates
+	capacity int // max pending urls, 0 means no limit
+
+	mu          sync.Mutex
+	queues      map[string][]URLInfo
+	order       []string // hosts which have pending urls
+	cursor      int
+	pending     int
+	delayed     []delayedURL // urls waiting for retry backoff
+	outstanding int          // urls pushed but not finished, include running and delayed ones
+	closed      bool
+	wake        chan struct{} // closed and renewed when urls are pushed or popped
+}
+
+type delayedURL struct {
+	info    URLInfo
+	readyAt time.Time
+}
+
+func newHostScheduler(ctx context.Context, hosts *hostStates, capacity int) *hostScheduler {
+	return &hostScheduler{
+		ctx:      ctx,
+		hosts:    hosts,
+		capacity: capacity,
+		queues:   make(map[string][]URLInfo),
+		wake:     make(chan struct{}),
+	}
+}
+
+func urlHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
+
+// Push block while scheduler is full, return error when ctx is done
+func (s *hostScheduler) Push(ctx context.Context, info URLInfo) error {
+	for {
+		s.mu.Lock()
+		if s.capacity <= 0 || s.pending < s.capacity {
+			s.enqueue(info)
+			s.outstanding++
+			s.broadcast()
+			s.mu.Unlock()
+			return nil
+		}
+		wake := s.wake
+		s.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Add push url discovered by workers without blocking, so workers won't dead lock,
+// return false when shutting down
+func (s *hostScheduler) Add(info URLInfo) bool {
+	if s.ctx.Err() != nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enqueue(info)
+	s.outstanding++
+	s.broadcast()
+	return true
+}
+
+// Retry push url back after delay, return false when shutting down
+func (s *hostScheduler) Retry(info URLInfo, delay time.Duration) bool {
+	if s.ctx.Err() != nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delayed = append(s.delayed, delayedURL{info: info, readyAt: time.Now().Add(delay)})
+	s.broadcast()
+	return true
+}
+
+// Finish must be called when url popped won't be retried any more
+func (s *hostScheduler) Finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.outstanding--
+	s.broadcast()
+}
+
+// Close mark no more urls will be pushed
+func (s *hostScheduler) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.broadcast()
+}
+
+// Pop block until one url can be dispatched,
+// return false when closed and all urls are finished
+func (s *hostScheduler) Pop() (URLInfo, bool) {
+	for {
+		// get it before checking, so we won't miss any release
+		hostWake := s.hosts.waitChan()
+		s.mu.Lock()
+		delayWait := s.promote()
+		info, wait, ok := s.next()
+		if ok {
+			s.broadcast()
+			s.mu.Unlock()
+			return info, true
+		}
+		if s.closed && s.outstanding == 0 {
+			s.mu.Unlock()
+			return URLInfo{}, false
+		}
+		if delayWait > 0 && (wait == 0 || delayWait < wait) {
+			wait = delayWait
+		}
+		wake := s.wake
+		s.mu.Unlock()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		done := s.ctx.Done()
+		if s.ctx.Err() != nil {
+			done = nil
+		}
+		select {
+		case <-wake:
+		case <-hostWake:
+		case <-timeout:
+		case <-done:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// Release must be called when url popped has been processed
+func (s *hostScheduler) Release(info URLInfo) {
+	s.hosts.release(urlHost(info.URL))
+}
+
+func (s *hostScheduler) enqueue(info URLInfo) {
+	host := urlHost(info.URL)
+	if _, ok := s.queues[host]; !ok {
+		s.order = append(s.order, host)
+	}
+	s.queues[host] = append(s.queues[host], info)
+	s.pending++
+}
+
+// promote move delayed urls which are ready to queues,
+// or return the min duration to wait for them
+func (s *hostScheduler) promote() time.Duration {
+	var minWait time.Duration
+	now := time.Now()
+	draining := s.ctx.Err() != nil
+	remain := s.delayed[:0]
+	for _, d := range s.delayed {
+		if draining || !d.readyAt.After(now) {
+			s.enqueue(d.info)
+			continue
+		}
+		if wait := d.readyAt.Sub(now); minWait == 0 || wait < minWait {
+			minWait = wait
+		}
+		remain = append(remain, d)
+	}
+	s.delayed = remain
+	return minWait
+}
+
+// next find the first host not blocked after cursor,
+// or return the min duration to wait for tokens
+func (s *hostScheduler) next() (URLInfo, time.Duration, bool) {
+	var minWait time.Duration
+	draining := s.ctx.Err() != nil
+	for i := 0; i < len(s.order); i++ {
+		idx := (s.cursor + i) % len(s.order)
+		host := s.order[idx]
+		queue := s.queues[host]
+		if !draining {
+			wait, ok := s.hosts.tryAcquire(host, queue[0].HostLimit)
+			if !ok {
+				if wait > 0 && (minWait == 0 || wait < minWait) {
+					minWait = wait
+				}
+				continue
+			}
+		}
+
+		info := queue[0]
+		s.pending--
+		if len(queue) == 1 {
+			delete(s.queues, host)
+			s.order = append(s.order[:idx], s.order[idx+1:]...)
+			s.cursor = idx
+		} else {
+			s.queues[host] = queue[1:]
+			s.cursor = idx + 1
+		}
+		if draining {
+			// keep running count balanced with Release
+			s.hosts.acquire(host)
+		}
+		return info, 0, true
+	}
+	return URLInfo{}, minWait, false
+}
+
+func (s *hostScheduler) broadcast() {
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
@@ -0,0 +1,135 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// runWorkers pop urls from scheduler until it's drained, like crawl workers
+func runWorkers(s *hostScheduler, workers int, handle func(info URLInfo)) {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				info, ok := s.Pop()
+				if !ok {
+					return
+				}
+				handle(info)
+				s.Release(info)
+				s.Finish()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func pushURLs(t *testing.T, s *hostScheduler, host string, n int, limit HostLimit) {
+	for i := 0; i < n; i++ {
+		info := URLInfo{URL: fmt.Sprintf("http://%s/%d", host, i), HostLimit: limit}
+		if err := s.Push(context.Background(), info); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHostSchedulerConcurrency(t *testing.T) {
+	s := newHostScheduler(context.Background(), newHostStates(), 0)
+	limits := map[string]HostLimit{
+		"a.example.com": {MaxConcurrency: 2},
+		"b.example.com": {MaxConcurrency: 1},
+		"c.example.com": {}, // no limit
+	}
+	for host, limit := range limits {
+		pushURLs(t, s, host, 20, limit)
+	}
+	s.Close()
+
+	var mu sync.Mutex
+	running := make(map[string]int)
+	maxRunning := make(map[string]int)
+	done := make(map[string]int)
+	runWorkers(s, 8, func(info URLInfo) {
+		host := urlHost(info.URL)
+		mu.Lock()
+		running[host]++
+		if running[host] > maxRunning[host] {
+			maxRunning[host] = running[host]
+		}
+		mu.Unlock()
+		time.Sleep(2 * time.Millisecond)
+		mu.Lock()
+		running[host]--
+		done[host]++
+		mu.Unlock()
+	})
+
+	for host, limit := range limits {
+		if done[host] != 20 {
+			t.Errorf("%s: %d urls done, want 20", host, done[host])
+		}
+		if limit.MaxConcurrency > 0 && maxRunning[host] > limit.MaxConcurrency {
+			t.Errorf("%s: %d urls ran at the same time, want at most %d", host, maxRunning[host], limit.MaxConcurrency)
+		}
+	}
+	if maxRunning["c.example.com"] < 2 {
+		t.Errorf("c.example.com: %d urls ran at the same time, want more without limit", maxRunning["c.example.com"])
+	}
+}
+
+func TestHostSchedulerHostsIndependent(t *testing.T) {
+	s := newHostScheduler(context.Background(), newHostStates(), 0)
+	// the slow host is blocked by its only running page, then by rate
+	pushURLs(t, s, "slow.example.com", 3, HostLimit{Rate: 20, Burst: 1, MaxConcurrency: 1})
+	pushURLs(t, s, "fast.example.com", 10, HostLimit{})
+	s.Close()
+
+	var mu sync.Mutex
+	var fast int
+	fastDone := make(chan struct{})
+	var order []string
+	runWorkers(s, 2, func(info URLInfo) {
+		host := urlHost(info.URL)
+		if host == "slow.example.com" {
+			select {
+			case <-fastDone:
+			case <-time.After(5 * time.Second):
+				t.Error("urls of fast host are blocked by slow host")
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, host)
+		if host == "fast.example.com" {
+			if fast++; fast == 10 {
+				close(fastDone)
+			}
+		}
+	})
+	if len(order) != 13 {
+		t.Fatalf("%d urls done, want 13", len(order))
+	}
+	for i, host := range order[:10] {
+		if host != "fast.example.com" {
+			t.Errorf("url %d done is of %s, want fast host first", i, host)
+		}
+	}
+}
+
+func TestHostSchedulerRate(t *testing.T) {
+	s := newHostScheduler(context.Background(), newHostStates(), 0)
+	pushURLs(t, s, "a.example.com", 5, HostLimit{Rate: 20, Burst: 1})
+	s.Close()
+
+	start := time.Now()
+	runWorkers(s, 5, func(info URLInfo) {})
+	// the first one is at once, then one every 50ms
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("5 urls at 20/s done in %v, want about 200ms", elapsed)
+	}
+}
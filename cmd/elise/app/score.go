@@ -0,0 +1,231 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/spf13/cast"
+	"golang.org/x/net/html"
+)
+
+// ImgGroup is a group of isomorphic images to be scored
+type ImgGroup struct {
+	ImgItems []ImgItem
+	LP       *url.URL // landing page
+}
+
+// ScoreFeature measure one aspect of image group, the score of group is
+// the sum of features multiplied by their weights
+type ScoreFeature interface {
+	Value(g *ImgGroup, s *Scorer) float64
+}
+
+// FeatureFunc is a ScoreFeature of function
+type FeatureFunc func(g *ImgGroup, s *Scorer) float64
+
+func (f FeatureFunc) Value(g *ImgGroup, s *Scorer) float64 {
+	return f(g, s)
+}
+
+// depthAttr is set to img node for the depth feature
+const depthAttr = "elise-depth"
+
+// scoreFeatures can be weighted in pic.yml
+var scoreFeatures = map[string]ScoreFeature{
+	"count":             FeatureFunc(featureCount),
+	"area":              FeatureFunc(featureArea),
+	"above_fold":        FeatureFunc(featureAboveFold),
+	"ratio_consistency": FeatureFunc(featureRatioConsistency),
+	"same_host":         FeatureFunc(featureSameHost),
+	"same_domain":       FeatureFunc(featureSameDomain),
+	"depth":             FeatureFunc(featureDepth),
+}
+
+func scoreFeatureNames() []string {
+	var names []string
+	for name := range scoreFeatures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Scorer score image groups by weighted features
+type Scorer struct {
+	Fold    float64            // images with top above it are visible without scrolling
+	Weights map[string]float64 // feature => weight
+}
+
+// defaultScorer score by image count only
+func defaultScorer() *Scorer {
+	return &Scorer{Fold: 768, Weights: map[string]float64{"count": 1}}
+}
+
+// parseScorer read 'score' conf of pic.yml, weights replace the default {count: 1}
+//
+//	score:
+//	  fold: 768
+//	  weights: {count: 1, area: 0.5, above_fold: 2, ratio_consistency: 1, same_domain: 1, depth: -0.1}
+func parseScorer(val interface{}) (*Scorer, error) {
+	conf, err := cast.ToStringMapE(val)
+	if err != nil {
+		return nil, err
+	}
+	s := defaultScorer()
+	for key, v := range conf {
+		switch key {
+		case "fold":
+			if s.Fold, err = cast.ToFloat64E(v); err == nil && s.Fold <= 0 {
+				err = fmt.Errorf("should be positive")
+			}
+		case "weights":
+			s.Weights, err = parseWeights(v)
+		default:
+			err = fmt.Errorf("unknown key")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid score conf %q: %v", key, err)
+		}
+	}
+	return s, nil
+}
+
+func parseWeights(val interface{}) (map[string]float64, error) {
+	conf, err := cast.ToStringMapE(val)
+	if err != nil {
+		return nil, err
+	}
+	weights := make(map[string]float64)
+	for name, v := range conf {
+		if _, ok := scoreFeatures[name]; !ok {
+			return nil, fmt.Errorf("unknown feature %q, should be one of %v", name, scoreFeatureNames())
+		}
+		if weights[name], err = cast.ToFloat64E(v); err != nil {
+			return nil, fmt.Errorf("weight of %q: %v", name, err)
+		}
+	}
+	return weights, nil
+}
+
+// Score return weighted sum of features and value of each feature
+func (s *Scorer) Score(g *ImgGroup) (float64, map[string]float64) {
+	var score float64
+	values := make(map[string]float64)
+	for name, weight := range s.Weights {
+		if weight == 0 {
+			continue
+		}
+		v := scoreFeatures[name].Value(g, s)
+		values[name] = v
+		score += weight * v
+	}
+	return score, values
+}
+
+func featureCount(g *ImgGroup, s *Scorer) float64 {
+	return float64(len(g.ImgItems))
+}
+
+// featureArea is total area of images, in 100x100 pixels
+func featureArea(g *ImgGroup, s *Scorer) float64 {
+	var area float64
+	for _, img := range g.ImgItems {
+		area += img.Width * img.Height
+	}
+	return area / 10000
+}
+
+// featureAboveFold is the fraction of images visible without scrolling
+func featureAboveFold(g *ImgGroup, s *Scorer) float64 {
+	if len(g.ImgItems) == 0 {
+		return 0
+	}
+	var n int
+	for _, img := range g.ImgItems {
+		if img.Top < s.Fold {
+			n++
+		}
+	}
+	return float64(n) / float64(len(g.ImgItems))
+}
+
+// featureRatioConsistency is 1 for images with the same width/height ratio,
+// it decreases to 0 with the coefficient of variation of ratios
+func featureRatioConsistency(g *ImgGroup, s *Scorer) float64 {
+	n := float64(len(g.ImgItems))
+	if n == 0 {
+		return 0
+	}
+	var sum float64
+	for _, img := range g.ImgItems {
+		sum += img.Ratio
+	}
+	mean := sum / n
+	if mean <= 0 {
+		return 0
+	}
+	var variance float64
+	for _, img := range g.ImgItems {
+		variance += (img.Ratio - mean) * (img.Ratio - mean)
+	}
+	cv := math.Sqrt(variance/n) / mean
+	return math.Max(0, 1-cv)
+}
+
+// featureSameHost is the fraction of images on the host of landing page
+func featureSameHost(g *ImgGroup, s *Scorer) float64 {
+	host := strings.ToLower(g.LP.Hostname())
+	return imgFraction(g, func(u *url.URL) bool {
+		return strings.ToLower(u.Hostname()) == host
+	})
+}
+
+// featureSameDomain is the fraction of images on the registered domain of landing page,
+// images on cdn of the site are counted
+func featureSameDomain(g *ImgGroup, s *Scorer) float64 {
+	domain := registeredDomain(strings.ToLower(g.LP.Hostname()))
+	return imgFraction(g, func(u *url.URL) bool {
+		return registeredDomain(strings.ToLower(u.Hostname())) == domain
+	})
+}
+
+func imgFraction(g *ImgGroup, match func(u *url.URL) bool) float64 {
+	if len(g.ImgItems) == 0 {
+		return 0
+	}
+	var n int
+	for _, img := range g.ImgItems {
+		if u, err := url.Parse(img.Src); err == nil && match(u) {
+			n++
+		}
+	}
+	return float64(n) / float64(len(g.ImgItems))
+}
+
+// featureDepth is the average depth of images in DOM, html node is 1
+func featureDepth(g *ImgGroup, s *Scorer) float64 {
+	if len(g.ImgItems) == 0 {
+		return 0
+	}
+	var depth int
+	for _, img := range g.ImgItems {
+		depth += img.Depth
+	}
+	return float64(depth) / float64(len(g.ImgItems))
+}
+
+// markImgDepth keep depth of images in attribute, since groups are extracted into new trees
+func markImgDepth(doc *goquery.Document) {
+	doc.Find("img").Each(func(_ int, sel *goquery.Selection) {
+		var depth int
+		for n := sel.Nodes[0]; n != nil && n.Type == html.ElementNode; n = n.Parent {
+			depth++
+		}
+		sel.SetAttr(depthAttr, strconv.Itoa(depth))
+	})
+}
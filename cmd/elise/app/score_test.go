@@ -0,0 +1,155 @@
+package app
+
+import (
+	"math"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseScorer(t *testing.T) {
+	tests := []struct {
+		conf interface{}
+		want *Scorer
+		err  string
+	}{
+		{map[string]interface{}{}, defaultScorer(), ""},
+		{
+			map[string]interface{}{
+				"fold":    "1000",
+				"weights": map[string]interface{}{"area": 0.5, "depth": -0.1, "count": 0},
+			},
+			&Scorer{Fold: 1000, Weights: map[string]float64{"area": 0.5, "depth": -0.1, "count": 0}},
+			"",
+		},
+		// weights replace the default, not merged
+		{
+			map[string]interface{}{"weights": map[string]interface{}{"same_domain": 2}},
+			&Scorer{Fold: 768, Weights: map[string]float64{"same_domain": 2}},
+			"",
+		},
+		{768, nil, "unable to cast"},
+		{map[string]interface{}{"folds": 768}, nil, `"folds": unknown key`},
+		{map[string]interface{}{"fold": 0}, nil, "should be positive"},
+		{map[string]interface{}{"fold": -768}, nil, "should be positive"},
+		{map[string]interface{}{"fold": "abc"}, nil, `"fold"`},
+		{map[string]interface{}{"weights": map[string]interface{}{"size": 1}}, nil, `unknown feature "size"`},
+		{map[string]interface{}{"weights": map[string]interface{}{"count": "many"}}, nil, `weight of "count"`},
+		{map[string]interface{}{"weights": []interface{}{"count"}}, nil, `"weights"`},
+	}
+	for _, tt := range tests {
+		got, err := parseScorer(tt.conf)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parseScorer(%v) error = %v, want %q", tt.conf, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseScorer(%v) = %+v %v, want %+v", tt.conf, got, err, tt.want)
+		}
+	}
+}
+
+func TestScoreFeatures(t *testing.T) {
+	lp, _ := url.Parse("https://www.example.com/gallery")
+	tests := []struct {
+		name string
+		imgs []ImgItem
+		want map[string]float64
+	}{
+		{
+			"empty",
+			nil,
+			map[string]float64{
+				"count": 0, "area": 0, "above_fold": 0, "ratio_consistency": 0,
+				"same_host": 0, "same_domain": 0, "depth": 0,
+			},
+		},
+		{
+			"uniform",
+			[]ImgItem{
+				{Src: "https://www.example.com/1.jpg", Top: 0, Width: 200, Height: 100, Ratio: 2, Depth: 5},
+				{Src: "https://www.example.com/2.jpg", Top: 300, Width: 200, Height: 100, Ratio: 2, Depth: 5},
+				{Src: "https://WWW.EXAMPLE.COM/3.jpg", Top: 600, Width: 200, Height: 100, Ratio: 2, Depth: 5},
+			},
+			map[string]float64{
+				"count": 3, "area": 6, "above_fold": 1, "ratio_consistency": 1,
+				"same_host": 1, "same_domain": 1, "depth": 5,
+			},
+		},
+		{
+			"mixed",
+			[]ImgItem{
+				{Src: "https://img.example.com/1.jpg", Top: 0, Width: 100, Height: 100, Ratio: 1, Depth: 4},
+				{Src: "https://cdn.example.net/2.jpg", Top: 1000, Width: 300, Height: 100, Ratio: 3, Depth: 6},
+			},
+			map[string]float64{
+				// ratios 1 and 3 have mean 2 and standard deviation 1
+				"count": 2, "area": 4, "above_fold": 0.5, "ratio_consistency": 0.5,
+				"same_host": 0, "same_domain": 0.5, "depth": 5,
+			},
+		},
+		{
+			"scattered ratios",
+			[]ImgItem{
+				{Src: "/1.jpg", Width: 10, Height: 100, Ratio: 0.1},
+				{Src: "/2.jpg", Width: 10, Height: 100, Ratio: 0.1},
+				{Src: "/3.jpg", Width: 10, Height: 100, Ratio: 0.1},
+				{Src: "/4.jpg", Width: 1000, Height: 100, Ratio: 10},
+			},
+			// relative urls are not on any host
+			map[string]float64{"ratio_consistency": 0, "same_host": 0, "same_domain": 0},
+		},
+		{
+			"unknown size",
+			[]ImgItem{{Src: "https://www.example.com/1.jpg"}, {Src: "https://www.example.com/2.jpg"}},
+			map[string]float64{"area": 0, "ratio_consistency": 0},
+		},
+	}
+	s := defaultScorer()
+	for _, tt := range tests {
+		g := &ImgGroup{ImgItems: tt.imgs, LP: lp}
+		for name, want := range tt.want {
+			if got := scoreFeatures[name].Value(g, s); math.Abs(got-want) > 1e-9 {
+				t.Errorf("%s of %s group = %v, want %v", name, tt.name, got, want)
+			}
+		}
+	}
+}
+
+func TestScorerScore(t *testing.T) {
+	lp, _ := url.Parse("https://www.example.com/")
+	g := &ImgGroup{
+		LP: lp,
+		ImgItems: []ImgItem{
+			{Src: "https://www.example.com/1.jpg", Top: 0, Width: 100, Height: 100, Ratio: 1, Depth: 8},
+			{Src: "https://www.example.com/2.jpg", Top: 900, Width: 100, Height: 100, Ratio: 1, Depth: 8},
+		},
+	}
+	tests := []struct {
+		weights map[string]float64
+		score   float64
+		values  map[string]float64
+	}{
+		{map[string]float64{}, 0, map[string]float64{}},
+		{map[string]float64{"count": 1}, 2, map[string]float64{"count": 2}},
+		// features of zero weight are not computed
+		{map[string]float64{"count": 1, "area": 0}, 2, map[string]float64{"count": 2}},
+		// negative weight penalizes
+		{
+			map[string]float64{"count": 1, "depth": -0.5, "above_fold": 2},
+			2 - 4 + 1,
+			map[string]float64{"count": 2, "depth": 8, "above_fold": 0.5},
+		},
+		{map[string]float64{"depth": -1}, -8, map[string]float64{"depth": 8}},
+	}
+	for _, tt := range tests {
+		s := &Scorer{Fold: 768, Weights: tt.weights}
+		score, values := s.Score(g)
+		if math.Abs(score-tt.score) > 1e-9 || !reflect.DeepEqual(values, tt.values) {
+			t.Errorf("Score with %v = %v %v, want %v %v", tt.weights, score, values, tt.score, tt.values)
+		}
+	}
+}
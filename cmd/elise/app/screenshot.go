@@ -0,0 +1,40 @@
+package app
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+)
+
+const screenshotDir = "screenshots"
+
+// screenshotter is implemented by pages which can render, png is saved to filename,
+// phantomjs always render the whole page
+type screenshotter interface {
+	Screenshot(filename string) error
+}
+
+// fullScreenshotter render the whole page instead of the viewport
+type fullScreenshotter interface {
+	FullScreenshot(filename string) error
+}
+
+// screenshotPath return path relative to output dir, keyed by url hash
+func screenshotPath(url string) string {
+	sum := sha1.Sum([]byte(url))
+	return filepath.Join(screenshotDir, hex.EncodeToString(sum[:])+".png")
+}
+
+// takeScreenshot save screenshot of page, mode is "viewport" or "fullpage"
+func takeScreenshot(page Page, url, mode string) (string, error) {
+	path := screenshotPath(url)
+	filename := filepath.Join(fEliseOutputDir, path)
+	if p, ok := page.(fullScreenshotter); ok && mode == "fullpage" {
+		return path, p.FullScreenshot(filename)
+	}
+	if p, ok := page.(screenshotter); ok {
+		return path, p.Screenshot(filename)
+	}
+	return "", fmt.Errorf("driver can't take screenshot")
+}
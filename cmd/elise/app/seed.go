@@ -0,0 +1,174 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// metaScriptName in metadata of seed override 'script_name' of data file
+const metaScriptName = "script_name"
+
+// SeedFormat describe how url and metadata are read from one line of data file
+type SeedFormat struct {
+	Format    string   // lines, tsv or jsonl
+	URLColumn string   // name of url column, or index start from 1 for tsv
+	Header    bool     // first line of tsv is names of columns
+	Columns   []string // names of tsv columns when there is no header
+
+	urlIndex int // index of url column for tsv, start from 0
+}
+
+// parseSeedFormat read 'input' conf of data file, 'input: jsonl' just set the format
+//
+//	input:
+//	  format: tsv
+//	  url_column: landing_url
+//	  header: true
+func parseSeedFormat(val interface{}) (*SeedFormat, error) {
+	f := &SeedFormat{Format: "lines"}
+	if format, ok := val.(string); ok {
+		f.Format = format
+	} else {
+		conf, err := cast.ToStringMapE(val)
+		if err != nil {
+			return nil, err
+		}
+		for key, v := range conf {
+			switch key {
+			case "format":
+				f.Format, err = cast.ToStringE(v)
+			case "url_column":
+				f.URLColumn, err = cast.ToStringE(v)
+			case "header":
+				f.Header, err = cast.ToBoolE(v)
+			case "columns":
+				f.Columns, err = cast.ToStringSliceE(v)
+			default:
+				return nil, fmt.Errorf("unknown input conf %q", key)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid input conf %q: %v", key, err)
+			}
+		}
+	}
+
+	switch f.Format {
+	case "lines":
+		return f, nil
+	case "jsonl":
+		if f.URLColumn == "" {
+			f.URLColumn = "url"
+		}
+		return f, nil
+	case "tsv":
+		if f.URLColumn == "" {
+			if f.Header || len(f.Columns) > 0 {
+				f.URLColumn = "url"
+			} else {
+				f.URLColumn = "1"
+			}
+		}
+		if f.Header {
+			// resolved when header is read
+			return f, nil
+		}
+		return f, f.resolve()
+	default:
+		return nil, fmt.Errorf("format should be one of lines, tsv and jsonl")
+	}
+}
+
+// NeedHeader return true if first line of data file should be passed to SetHeader
+func (f *SeedFormat) NeedHeader() bool {
+	return f.Format == "tsv" && f.Header
+}
+
+// SetHeader read names of tsv columns from first line of data file
+func (f *SeedFormat) SetHeader(line string) error {
+	f.Columns = strings.Split(line, "\t")
+	return f.resolve()
+}
+
+func (f *SeedFormat) resolve() error {
+	if n, err := strconv.Atoi(f.URLColumn); err == nil {
+		if n < 1 {
+			return fmt.Errorf("url_column index should start from 1")
+		}
+		f.urlIndex = n - 1
+		return nil
+	}
+	for i, name := range f.Columns {
+		if name == f.URLColumn {
+			f.urlIndex = i
+			return nil
+		}
+	}
+	return fmt.Errorf("url column %q not found in %v", f.URLColumn, f.Columns)
+}
+
+// Parse return url and metadata of seed, metadata is nil for lines format
+func (f *SeedFormat) Parse(line string) (string, map[string]interface{}, error) {
+	switch f.Format {
+	case "tsv":
+		values := strings.Split(line, "\t")
+		if f.urlIndex >= len(values) {
+			return "", nil, fmt.Errorf("line has %d columns, url is in column %d", len(values), f.urlIndex+1)
+		}
+		meta := make(map[string]interface{})
+		for i, v := range values {
+			if i == f.urlIndex {
+				continue
+			}
+			meta[f.column(i)] = v
+		}
+		return values[f.urlIndex], meta, nil
+	case "jsonl":
+		var meta map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &meta); err != nil {
+			return "", nil, err
+		}
+		url, ok := meta[f.URLColumn].(string)
+		if !ok {
+			return "", nil, fmt.Errorf("field %q is not a string", f.URLColumn)
+		}
+		delete(meta, f.URLColumn)
+		return url, meta, nil
+	}
+	return line, nil, nil
+}
+
+// column return name of tsv column, 'colN' when it's not named
+func (f *SeedFormat) column(i int) string {
+	if i < len(f.Columns) && f.Columns[i] != "" {
+		return f.Columns[i]
+	}
+	return "col" + strconv.Itoa(i+1)
+}
+
+// scriptLoader read scripts in script dir, scripts are cached since seeds may share them
+type scriptLoader map[string]string
+
+// Load return content of scripts in the same order
+func (l scriptLoader) Load(names []string) ([]string, error) {
+	var scripts []string
+	for _, name := range names {
+		path := filepath.Join(fCrawlScriptDir, name)
+		script, ok := l[path]
+		if !ok {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			script = string(data)
+			l[path] = script
+		}
+		scripts = append(scripts, script)
+	}
+	return scripts, nil
+}
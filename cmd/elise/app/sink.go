@@ -0,0 +1,332 @@
+package app
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sink store results of one data file, failures included,
+// result must be stored when Write return, since checkpoint is marked after it
+type Sink interface {
+	Write(res URLRes) error
+	Close() error
+}
+
+// sinkFormat open sinks, and read urls stored by previous run for resume
+type sinkFormat interface {
+	Open(noSuffix string, resume bool) (Sink, error)
+	ScanURLs(noSuffix string, fn func(url string)) error
+}
+
+var sinkFormats = map[string]sinkFormat{
+	"tsv":      &splitFormat{ext: ".txt", encode: encodeTSV, decodeURL: decodeTSVURL},
+	"tsv.gz":   &splitFormat{ext: ".txt.gz", gzip: true, encode: encodeTSV, decodeURL: decodeTSVURL},
+	"jsonl":    &splitFormat{ext: ".jsonl", encode: encodeJSONL, decodeURL: decodeJSONLURL},
+	"jsonl.gz": &splitFormat{ext: ".jsonl.gz", gzip: true, encode: encodeJSONL, decodeURL: decodeJSONLURL},
+	"sqlite":   sqliteFormat{},
+}
+
+func sinkFormatNames() []string {
+	var names []string
+	for name := range sinkFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// splitFormat write results to text files split by fEliseSplitCnt lines,
+// failures are written to failed file
+type splitFormat struct {
+	ext       string
+	gzip      bool
+	encode    func(res URLRes) ([]byte, error)
+	decodeURL func(line string) (string, bool)
+}
+
+// path return path of the index-th split output file
+func (f *splitFormat) path(noSuffix string, index int) string {
+	if index == 0 {
+		return filepath.Join(fEliseOutputDir, noSuffix+f.ext)
+	}
+	return filepath.Join(fEliseOutputDir, noSuffix+"_"+strconv.Itoa(index)+f.ext)
+}
+
+func (f *splitFormat) Open(noSuffix string, resume bool) (Sink, error) {
+	s := &splitSink{format: f, noSuffix: noSuffix}
+	var err error
+	if resume {
+		// append to the last output file of previous run,
+		// a new gzip file is started since the last one may be truncated
+		s.index, s.line, err = f.lastOutput(noSuffix)
+		if err == nil && f.gzip {
+			if _, err := os.Stat(f.path(noSuffix, s.index)); err == nil {
+				s.index, s.line = s.index+1, 0
+			}
+		}
+	} else {
+		err = f.removeSplits(noSuffix)
+	}
+	if err == nil {
+		err = s.open(resume)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.failed, err = openFailed(noSuffix, resume); err != nil {
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// lastOutput find the last split output file and count its lines,
+// so we can continue to append to it
+func (f *splitFormat) lastOutput(noSuffix string) (index, line int, err error) {
+	for {
+		if _, err := os.Stat(f.path(noSuffix, index+1)); err != nil {
+			break
+		}
+		index++
+	}
+	err = f.scan(f.path(noSuffix, index), func(string) {
+		line++
+	})
+	if os.IsNotExist(err) {
+		return index, 0, nil
+	}
+	return index, line, err
+}
+
+// removeSplits delete split files of previous run, the first one is truncated when opened,
+// or they would be taken as output of this run when resume later
+func (f *splitFormat) removeSplits(noSuffix string) error {
+	for index := 1; ; index++ {
+		err := os.Remove(f.path(noSuffix, index))
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// ScanURLs call fn with url of every line in output files of previous run
+func (f *splitFormat) ScanURLs(noSuffix string, fn func(url string)) error {
+	for index := 0; ; index++ {
+		err := f.scan(f.path(noSuffix, index), func(line string) {
+			if url, ok := f.decodeURL(line); ok {
+				fn(url)
+			}
+		})
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// scan call fn with every complete line of file, gzip file truncated by crash is read until broken
+func (f *splitFormat) scan(path string, fn func(line string)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if f.gzip {
+		gz, err := gzip.NewReader(file)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, fEliseBufMaxSize*1024*1024)
+	sc.Split(scanCompleteLines)
+	for sc.Scan() {
+		fn(sc.Text())
+	}
+	if err := sc.Err(); err != nil && !(f.gzip && err == io.ErrUnexpectedEOF) {
+		return err
+	}
+	return nil
+}
+
+type splitSink struct {
+	format   *splitFormat
+	noSuffix string
+	index    int
+	line     int
+	file     *os.File
+	gz       *gzip.Writer // nil when not compressed
+	failed   *os.File
+}
+
+func (s *splitSink) open(appending bool) error {
+	var err error
+	path := s.format.path(s.noSuffix, s.index)
+	if appending {
+		if err = truncatePartialLine(path); err != nil {
+			return err
+		}
+		s.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	} else {
+		s.file, err = os.Create(path)
+	}
+	if err != nil {
+		return err
+	}
+	if s.format.gzip {
+		s.gz = gzip.NewWriter(s.file)
+	}
+	return nil
+}
+
+func (s *splitSink) close() error {
+	if s.gz != nil {
+		if err := s.gz.Close(); err != nil {
+			s.file.Close()
+			return err
+		}
+	}
+	return s.file.Close()
+}
+
+func (s *splitSink) Write(res URLRes) error {
+	if res.Err != nil {
+		return writeFailed(s.failed, res)
+	}
+	if res.Res == nil {
+		return nil
+	}
+	data, err := s.format.encode(res)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if s.gz != nil {
+		// flush so result is readable even if we crash later
+		if _, err = s.gz.Write(data); err == nil {
+			err = s.gz.Flush()
+		}
+	} else {
+		_, err = s.file.Write(data)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.line++
+	if s.line >= fEliseSplitCnt {
+		if err := s.close(); err != nil {
+			return err
+		}
+		s.line = 0
+		s.index++
+		return s.open(false)
+	}
+	return nil
+}
+
+func (s *splitSink) Close() error {
+	err := s.close()
+	if ferr := s.failed.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// encodeTSV return "url\tresult", metadata of seed is appended as json
+func encodeTSV(res URLRes) ([]byte, error) {
+	data, err := json.Marshal(res.Res)
+	if err != nil {
+		return nil, err
+	}
+	line := res.URL + "\t" + string(data)
+	if res.Meta != nil {
+		meta, err := json.Marshal(res.Meta)
+		if err != nil {
+			return nil, err
+		}
+		line += "\t" + string(meta)
+	}
+	return []byte(line), nil
+}
+
+func decodeTSVURL(line string) (string, bool) {
+	fields := strings.SplitN(line, "\t", 2)
+	return fields[0], len(fields) == 2
+}
+
+type jsonlRecord struct {
+	URL    string                 `json:"url"`
+	Result map[string]interface{} `json:"result"`
+	Meta   map[string]interface{} `json:"meta,omitempty"`
+}
+
+func encodeJSONL(res URLRes) ([]byte, error) {
+	return json.Marshal(jsonlRecord{URL: res.URL, Result: res.Res, Meta: res.Meta})
+}
+
+func decodeJSONLURL(line string) (string, bool) {
+	var rec struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal([]byte(line), &rec); err != nil || rec.URL == "" {
+		return "", false
+	}
+	return rec.URL, true
+}
+
+// failedPath return path of the file recording urls which exhausted retries
+func failedPath(noSuffix string) string {
+	return filepath.Join(fEliseOutputDir, noSuffix+".failed")
+}
+
+// openFailed append to failed file of previous run when resume
+func openFailed(noSuffix string, resume bool) (*os.File, error) {
+	if resume {
+		if err := truncatePartialLine(failedPath(noSuffix)); err != nil {
+			return nil, err
+		}
+		return os.OpenFile(failedPath(noSuffix), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	}
+	return os.Create(failedPath(noSuffix))
+}
+
+// writeFailed write "url\tline\tattempt\tkind\terror", url comes first,
+// so urls can be cut out and fed as data file again, metadata of seed is appended as json
+func writeFailed(file *os.File, res URLRes) error {
+	msg := strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(errCause(res.Err).Error())
+	if res.Meta == nil {
+		_, err := fmt.Fprintf(file, "%s\t%d\t%d\t%s\t%s\n", res.URL, res.Line, res.Attempt, errKindOf(res.Err), msg)
+		return err
+	}
+	meta, _ := json.Marshal(res.Meta)
+	_, err := fmt.Fprintf(file, "%s\t%d\t%d\t%s\t%s\t%s\n", res.URL, res.Line, res.Attempt, errKindOf(res.Err), msg, meta)
+	return err
+}
+
+// errCause strip the kind of parseError
+func errCause(err error) error {
+	var pe *parseError
+	if errors.As(err, &pe) {
+		return pe.Err
+	}
+	return err
+}
@@ -0,0 +1,150 @@
+package app
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// one row per url, url crawled again replace the old row
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS results (
+	url        TEXT PRIMARY KEY,
+	line       INTEGER NOT NULL,
+	status     TEXT NOT NULL,
+	attempt    INTEGER NOT NULL,
+	error_kind TEXT,
+	error      TEXT,
+	result     TEXT,
+	meta       TEXT,
+	crawled_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS results_status ON results (status);
+`
+
+// sqliteFormat write results of one data file to a sqlite database,
+// status is "ok" or "failed", result is null when script stop parsing.
+// Failed urls are written to failed file too, like other formats.
+type sqliteFormat struct{}
+
+func (sqliteFormat) path(noSuffix string) string {
+	return filepath.Join(fEliseOutputDir, noSuffix+".db")
+}
+
+func (f sqliteFormat) open(noSuffix string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", f.path(noSuffix)+"?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	// results are written by one goroutine
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+func (f sqliteFormat) Open(noSuffix string, resume bool) (Sink, error) {
+	if !resume {
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			if err := os.Remove(f.path(noSuffix) + suffix); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+	}
+	db, err := f.open(noSuffix)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	stmt, err := db.Prepare(`INSERT OR REPLACE INTO results
+		(url, line, status, attempt, error_kind, error, result, meta, crawled_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	failed, err := openFailed(noSuffix, resume)
+	if err != nil {
+		stmt.Close()
+		db.Close()
+		return nil, err
+	}
+	return &sqliteSink{db: db, insert: stmt, failed: failed}, nil
+}
+
+// ScanURLs call fn with urls crawled successfully by previous run
+func (f sqliteFormat) ScanURLs(noSuffix string, fn func(url string)) error {
+	if _, err := os.Stat(f.path(noSuffix)); os.IsNotExist(err) {
+		return nil
+	}
+	db, err := f.open(noSuffix)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT url FROM results WHERE status = 'ok'`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return err
+		}
+		fn(url)
+	}
+	return rows.Err()
+}
+
+type sqliteSink struct {
+	db     *sql.DB
+	insert *sql.Stmt
+	failed *os.File
+}
+
+func (s *sqliteSink) Write(res URLRes) error {
+	status := "ok"
+	var kind, msg, result, meta sql.NullString
+	if res.Err != nil {
+		status = "failed"
+		kind = sql.NullString{String: string(errKindOf(res.Err)), Valid: true}
+		msg = sql.NullString{String: errCause(res.Err).Error(), Valid: true}
+	}
+	if res.Res != nil {
+		data, err := json.Marshal(res.Res)
+		if err != nil {
+			return err
+		}
+		result = sql.NullString{String: string(data), Valid: true}
+	}
+	if res.Meta != nil {
+		data, err := json.Marshal(res.Meta)
+		if err != nil {
+			return err
+		}
+		meta = sql.NullString{String: string(data), Valid: true}
+	}
+	if _, err := s.insert.Exec(res.URL, res.Line, status, res.Attempt, kind, msg, result, meta, time.Now()); err != nil {
+		return err
+	}
+	if res.Err != nil {
+		return writeFailed(s.failed, res)
+	}
+	return nil
+}
+
+func (s *sqliteSink) Close() error {
+	s.insert.Close()
+	err := s.db.Close()
+	if ferr := s.failed.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
@@ -0,0 +1,171 @@
+package app
+
+import (
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// useOutputDir point output of sinks to a temp dir
+func useOutputDir(t *testing.T, splitCnt int) string {
+	dir, cnt, size := fEliseOutputDir, fEliseSplitCnt, fEliseBufMaxSize
+	t.Cleanup(func() {
+		fEliseOutputDir, fEliseSplitCnt, fEliseBufMaxSize = dir, cnt, size
+	})
+	fEliseOutputDir, fEliseSplitCnt, fEliseBufMaxSize = t.TempDir(), splitCnt, 1
+	return fEliseOutputDir
+}
+
+func writeResults(t *testing.T, format sinkFormat, resume bool, results ...URLRes) {
+	sink, err := format.Open("data", resume)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range results {
+		if err := sink.Write(res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func scanURLs(t *testing.T, format sinkFormat) []string {
+	var urls []string
+	if err := format.ScanURLs("data", func(url string) {
+		urls = append(urls, url)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// failedURLs return urls in failed file, url is the first field
+func failedURLs(t *testing.T) []string {
+	data, err := ioutil.ReadFile(failedPath("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var urls []string
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if line != "" {
+			urls = append(urls, strings.SplitN(line, "\t", 2)[0])
+		}
+	}
+	return urls
+}
+
+var sinkTestResults = []URLRes{
+	{URL: "http://a.example.com/", Line: 1, Res: map[string]interface{}{"title": "a"}, Attempt: 1},
+	{URL: "http://b.example.com/", Line: 2, Err: newParseError(ErrNavigate, errors.New("404\tnot found")), Attempt: 2},
+	{URL: "http://c.example.com/", Line: 3, Res: map[string]interface{}{"title": "c"}, Attempt: 1,
+		Meta: map[string]interface{}{"id": "c"}},
+	{URL: "http://d.example.com/", Line: 4, Res: map[string]interface{}{"title": "d\td"}, Attempt: 1},
+}
+
+func TestSinkFormats(t *testing.T) {
+	for _, name := range sinkFormatNames() {
+		t.Run(name, func(t *testing.T) {
+			useOutputDir(t, 2)
+			format := sinkFormats[name]
+			writeResults(t, format, false, sinkTestResults...)
+			want := []string{"http://a.example.com/", "http://c.example.com/", "http://d.example.com/"}
+			if got := scanURLs(t, format); !reflect.DeepEqual(got, want) {
+				t.Errorf("urls of output = %v, want %v", got, want)
+			}
+			if got := failedURLs(t); !reflect.DeepEqual(got, []string{"http://b.example.com/"}) {
+				t.Errorf("urls of failed file = %v, want [http://b.example.com/]", got)
+			}
+
+			// resume append to outputs of previous run
+			writeResults(t, format, true,
+				URLRes{URL: "http://e.example.com/", Line: 5, Res: map[string]interface{}{"title": "e"}, Attempt: 1},
+				URLRes{URL: "http://f.example.com/", Line: 6, Err: newParseError(ErrScript, errors.New("undefined")), Attempt: 2})
+			want = append(want, "http://e.example.com/")
+			if got := scanURLs(t, format); !reflect.DeepEqual(got, want) {
+				t.Errorf("urls of output after resume = %v, want %v", got, want)
+			}
+			if got := failedURLs(t); !reflect.DeepEqual(got, []string{"http://b.example.com/", "http://f.example.com/"}) {
+				t.Errorf("urls of failed file after resume = %v", got)
+			}
+
+			// outputs of previous run are dropped without resume
+			writeResults(t, format, false, sinkTestResults[0])
+			if got := scanURLs(t, format); !reflect.DeepEqual(got, want[:1]) {
+				t.Errorf("urls of output after restart = %v, want %v", got, want[:1])
+			}
+		})
+	}
+}
+
+func TestSplitSinkFiles(t *testing.T) {
+	dir := useOutputDir(t, 2)
+	writeResults(t, sinkFormats["tsv"], false, sinkTestResults...)
+	for file, want := range map[string]string{
+		"data.txt":    "http://a.example.com/\t{\"title\":\"a\"}\nhttp://c.example.com/\t{\"title\":\"c\"}\t{\"id\":\"c\"}\n",
+		"data_1.txt":  "http://d.example.com/\t{\"title\":\"d\\td\"}\n",
+		"data.failed": "http://b.example.com/\t2\t2\tnavigate_error\t404 not found\n",
+	} {
+		if data, err := ioutil.ReadFile(filepath.Join(dir, file)); err != nil || string(data) != want {
+			t.Errorf("%s = %q %v, want %q", file, data, err, want)
+		}
+	}
+}
+
+func TestSplitSinkResumePartial(t *testing.T) {
+	partials := map[string]string{
+		"tsv":   "http://x.example.com/\t{\"ti",
+		"jsonl": `{"url":"http://x.example.com/","res`,
+	}
+	for name, partial := range partials {
+		t.Run(name, func(t *testing.T) {
+			dir := useOutputDir(t, 10)
+			format := sinkFormats[name]
+			writeResults(t, format, false, sinkTestResults[:2]...)
+			// crashed while writing results
+			appendFile(t, filepath.Join(dir, "data"+format.(*splitFormat).ext), partial)
+			appendFile(t, failedPath("data"), "http://x.example.com/\t7")
+
+			writeResults(t, format, true, sinkTestResults[2:]...)
+			want := []string{"http://a.example.com/", "http://c.example.com/", "http://d.example.com/"}
+			if got := scanURLs(t, format); !reflect.DeepEqual(got, want) {
+				t.Errorf("urls of output = %v, want %v", got, want)
+			}
+			if got := failedURLs(t); !reflect.DeepEqual(got, []string{"http://b.example.com/"}) {
+				t.Errorf("urls of failed file = %v, want [http://b.example.com/]", got)
+			}
+		})
+	}
+}
+
+func TestGzipSinkResumeTruncated(t *testing.T) {
+	dir := useOutputDir(t, 10)
+	format := sinkFormats["tsv.gz"]
+	// crashed while writing the second result, gzip is not closed
+	file, err := os.Create(filepath.Join(dir, "data.txt.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(file)
+	gz.Write([]byte("http://a.example.com/\t{}\nhttp://b.example.com/\t{\"ti"))
+	gz.Flush()
+	file.Close()
+
+	writeResults(t, format, true, sinkTestResults[2])
+	want := []string{"http://a.example.com/", "http://c.example.com/"}
+	if got := scanURLs(t, format); !reflect.DeepEqual(got, want) {
+		t.Errorf("urls of output = %v, want %v", got, want)
+	}
+	// a new file is started after the truncated one
+	if _, err := os.Stat(filepath.Join(dir, "data_1.txt.gz")); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,154 @@
+package app
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// pictureAttr is set to img in <picture>, it's the srcset of all <source>
+const pictureAttr = "elise-srcset"
+
+// defaultLazyAttrs hold the real src of lazy images, names end with 'srcset' are srcset
+var defaultLazyAttrs = []string{"data-original", "data-src", "data-lazy-src", "data-srcset", "lazy-src", "data-url"}
+
+// lazyAttrs can be set by 'lazy_attrs' in pic.yml
+var lazyAttrs = defaultLazyAttrs
+
+// ImgCandidate is one image of srcset
+type ImgCandidate struct {
+	URL     string
+	Width   int     // 'w' descriptor, 0 if absent
+	Density float64 // 'x' descriptor, 1 if absent
+}
+
+// parseSrcset parse "a.jpg 300w, b.jpg 600w" or "a.jpg, b.jpg 2x", invalid candidates are skipped
+func parseSrcset(srcset string) []ImgCandidate {
+	var candidates []ImgCandidate
+	s := srcset
+	for {
+		s = strings.TrimLeftFunc(s, func(r rune) bool { return unicode.IsSpace(r) || r == ',' })
+		if s == "" {
+			return candidates
+		}
+		end := strings.IndexFunc(s, unicode.IsSpace)
+		if end < 0 {
+			end = len(s)
+		}
+		url := s[:end]
+		s = s[end:]
+		var descs string
+		if strings.HasSuffix(url, ",") {
+			url = strings.TrimRight(url, ",")
+		} else {
+			// descriptors end with comma which is not in parentheses
+			depth := 0
+			end := strings.IndexFunc(s, func(r rune) bool {
+				switch r {
+				case '(':
+					depth++
+				case ')':
+					depth--
+				case ',':
+					return depth <= 0
+				}
+				return false
+			})
+			if end < 0 {
+				end = len(s)
+			}
+			descs = s[:end]
+			s = s[end:]
+		}
+		if c, ok := parseCandidate(url, descs); ok {
+			candidates = append(candidates, c)
+		}
+	}
+}
+
+func parseCandidate(url, descs string) (ImgCandidate, bool) {
+	c := ImgCandidate{URL: url, Density: 1}
+	if url == "" || strings.HasPrefix(url, "data:") {
+		return c, false
+	}
+	// every descriptor appears once at most, and 'w' can't be used with 'x'
+	seen := make(map[byte]bool)
+	for _, d := range strings.Fields(descs) {
+		if len(d) < 2 {
+			return c, false
+		}
+		val, typ := d[:len(d)-1], d[len(d)-1]
+		if seen[typ] {
+			return c, false
+		}
+		seen[typ] = true
+		switch typ {
+		case 'w':
+			w, err := strconv.Atoi(val)
+			if err != nil || w <= 0 {
+				return c, false
+			}
+			c.Width = w
+		case 'x':
+			x, err := strconv.ParseFloat(val, 64)
+			if err != nil || x <= 0 {
+				return c, false
+			}
+			c.Density = x
+		case 'h':
+			// future-compat descriptor, ignored
+		default:
+			return c, false
+		}
+	}
+	return c, !(seen['w'] && seen['x'])
+}
+
+// bestCandidate return the widest candidate, or the densest one if there is no width,
+// since we can't know the viewport of picture
+func bestCandidate(candidates []ImgCandidate) (ImgCandidate, bool) {
+	var best ImgCandidate
+	for i, c := range candidates {
+		switch {
+		case i == 0:
+		case c.Width != best.Width:
+			if c.Width < best.Width {
+				continue
+			}
+		case c.Density <= best.Density:
+			continue
+		}
+		best = c
+	}
+	return best, len(candidates) > 0
+}
+
+// isSrcsetAttr return true for srcset and lazy attributes like data-srcset
+func isSrcsetAttr(name string) bool {
+	return strings.HasSuffix(name, "srcset")
+}
+
+// markPictureSources keep srcset of <source> in img of <picture>, since
+// sources are trimmed as leaves without image. Media queries are ignored.
+func markPictureSources(doc *goquery.Document) {
+	doc.Find("picture").Each(func(_ int, sel *goquery.Selection) {
+		img := sel.Find("img").First()
+		if img.Length() == 0 {
+			return
+		}
+		var srcsets []string
+		sel.Find("source").Each(func(_ int, source *goquery.Selection) {
+			names := append([]string{"srcset"}, lazyAttrs...)
+			for _, name := range names {
+				if val, ok := source.Attr(name); ok && isSrcsetAttr(name) && strings.TrimSpace(val) != "" {
+					srcsets = append(srcsets, val)
+				}
+			}
+		})
+		if len(srcsets) > 0 {
+			img.SetAttr(pictureAttr, strings.Join(srcsets, ", "))
+		}
+	})
+}
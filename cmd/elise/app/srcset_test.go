@@ -0,0 +1,85 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSrcset(t *testing.T) {
+	tests := []struct {
+		srcset string
+		want   []ImgCandidate
+	}{
+		{"", nil},
+		{" , ", nil},
+		{"a.jpg", []ImgCandidate{{URL: "a.jpg", Density: 1}}},
+		{
+			"a.jpg 300w, b.jpg 600w,c.jpg 100w",
+			[]ImgCandidate{{"a.jpg", 300, 1}, {"b.jpg", 600, 1}, {"c.jpg", 100, 1}},
+		},
+		{
+			"a.jpg, b.jpg 2x,d.jpg 1.5x",
+			[]ImgCandidate{{"a.jpg", 0, 1}, {"b.jpg", 0, 2}, {"d.jpg", 0, 1.5}},
+		},
+		{
+			// commas in url are kept, the url ends with whitespace
+			"https://cdn.example.com/w_200,h_100/a.jpg 200w, https://cdn.example.com/w_400,h_200/a.jpg 400w",
+			[]ImgCandidate{
+				{"https://cdn.example.com/w_200,h_100/a.jpg", 200, 1},
+				{"https://cdn.example.com/w_400,h_200/a.jpg", 400, 1},
+			},
+		},
+		{
+			// commas in url are kept even without whitespace after them
+			"a.jpg,b.jpg 2x",
+			[]ImgCandidate{{"a.jpg,b.jpg", 0, 2}},
+		},
+		{
+			"a.jpg, b.jpg",
+			[]ImgCandidate{{"a.jpg", 0, 1}, {"b.jpg", 0, 1}},
+		},
+		{"a.jpg 100w,", []ImgCandidate{{"a.jpg", 100, 1}}},
+		{"a.jpg,", []ImgCandidate{{"a.jpg", 0, 1}}},
+		{
+			"data:image/gif;base64,R0lGODlhAQABAAAAACw= 1x, real.jpg 2x",
+			[]ImgCandidate{{"real.jpg", 0, 2}},
+		},
+		{
+			// invalid descriptors are skipped
+			"a.jpg 0w, b.jpg -1x, c.jpg 10q, d.jpg w, e.jpg 100w 2x, f.jpg 100w 200w, g.jpg 100w 50h",
+			[]ImgCandidate{{"g.jpg", 100, 1}},
+		},
+		{
+			// mixed descriptors
+			"a.jpg 1x, b.jpg 300w, c.jpg",
+			[]ImgCandidate{{"a.jpg", 0, 1}, {"b.jpg", 300, 1}, {"c.jpg", 0, 1}},
+		},
+	}
+	for _, tt := range tests {
+		if got := parseSrcset(tt.srcset); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSrcset(%q) = %v, want %v", tt.srcset, got, tt.want)
+		}
+	}
+}
+
+func TestBestCandidate(t *testing.T) {
+	tests := []struct {
+		srcset string
+		want   string
+	}{
+		{"", ""},
+		{"a.jpg 300w, b.jpg 600w, c.jpg 100w", "b.jpg"},
+		{"a.jpg, b.jpg 2x, c.jpg 1.5x", "b.jpg"},
+		// width wins over density, since it's the real size
+		{"a.jpg 3x, b.jpg 300w, c.jpg", "b.jpg"},
+		// the first one wins for the same descriptor
+		{"a.jpg 300w, b.jpg 300w", "a.jpg"},
+		{"data:image/png;base64,iVBORw0KGgo= 800w, a.jpg 200w", "a.jpg"},
+	}
+	for _, tt := range tests {
+		got, ok := bestCandidate(parseSrcset(tt.srcset))
+		if got.URL != tt.want || ok != (tt.want != "") {
+			t.Errorf("bestCandidate(%q) = %v %v, want %q", tt.srcset, got, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// time to wait for the page blocked by driver after the driver is killed
+const killWait = 10 * time.Second
+
+// Timeouts limit time spent on one url of data file
+type Timeouts struct {
+	PageLoad time.Duration // navigate, include redirects
+	Script   time.Duration // each script
+	URL      time.Duration // the whole url include waiting, 0 means no limit
+}
+
+// timeoutSetter is implemented by pages which can change timeouts of driver
+type timeoutSetter interface {
+	SetTimeouts(pageLoad, script time.Duration) error
+}
+
+func setTimeouts(page Page, t Timeouts) error {
+	if p, ok := page.(timeoutSetter); ok {
+		return p.SetTimeouts(t.PageLoad, t.Script)
+	}
+	return nil
+}
+
+// parseURLWithin return url_timeout error if parseURL is not finished before ctx is done,
+// kill is called to unblock the wedged driver, and the page is abandoned if it's still blocked
+func parseURLWithin(ctx context.Context, kill func(), index int, info URLInfo, driver Driver, proxy *url.URL) (map[string]interface{}, []string, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		return parseURL(index, info, driver, proxy)
+	}
+
+	type result struct {
+		res   map[string]interface{}
+		links []string
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		res, links, err := parseURL(index, info, driver, proxy)
+		done <- result{res, links, err}
+	}()
+	select {
+	case r := <-done:
+		return r.res, r.links, r.err
+	case <-ctx.Done():
+	}
+
+	log.WithFields(log.Fields{
+		"index":   index,
+		"url":     info.URL,
+		"timeout": info.Timeouts.URL,
+	}).Warn("Url deadline exceeded, kill driver")
+	kill()
+	select {
+	case <-done:
+	case <-time.After(killWait):
+		log.WithFields(log.Fields{
+			"index":  index,
+			"driver": info.Driver,
+		}).Warn("Page is still blocked after driver killed, abandon it")
+	}
+	return nil, nil, newParseError(ErrURLTimeout, ctx.Err())
+}
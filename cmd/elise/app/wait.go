@@ -0,0 +1,159 @@
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+const (
+	defaultWaitTimeout = 30 * time.Second
+	defaultNetworkIdle = 500 * time.Millisecond
+	waitPollInterval   = 100 * time.Millisecond
+)
+
+// waitConds are keys of script result, checked in this order
+var waitConds = []string{"waitForURLContains", "waitForSelector", "waitForExpression", "waitForNetworkIdle"}
+
+// waitCond is a condition returned by script, the next script won't run until it holds,
+// value is a string (idle milliseconds for waitForNetworkIdle) or {value: ..., timeout: ms},
+// 'waitTimeout' in result set the default timeout in milliseconds
+type waitCond struct {
+	Name    string
+	Value   string
+	Idle    time.Duration // only for waitForNetworkIdle
+	Timeout time.Duration
+}
+
+// networkIdler is implemented by pages which can observe network requests,
+// other pages fall back to polling resource timing in page
+type networkIdler interface {
+	WaitNetworkIdle(idle, timeout time.Duration) error
+}
+
+// popWaitConds remove wait keys from script result and return conditions
+func popWaitConds(res map[string]interface{}) ([]waitCond, error) {
+	timeout := defaultWaitTimeout
+	if val, ok := res["waitTimeout"]; ok {
+		delete(res, "waitTimeout")
+		ms, err := cast.ToFloat64E(val)
+		if err != nil {
+			return nil, fmt.Errorf("waitTimeout is not a number: %v", val)
+		}
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+
+	var conds []waitCond
+	for _, name := range waitConds {
+		val, ok := res[name]
+		if !ok {
+			continue
+		}
+		delete(res, name)
+		cond := waitCond{Name: name, Timeout: timeout}
+		if m, ok := val.(map[string]interface{}); ok {
+			val = m["value"]
+			if t, ok := m["timeout"]; ok {
+				ms, err := cast.ToFloat64E(t)
+				if err != nil {
+					return nil, fmt.Errorf("timeout of %s is not a number: %v", name, t)
+				}
+				cond.Timeout = time.Duration(ms) * time.Millisecond
+			}
+		}
+		if name == "waitForNetworkIdle" {
+			cond.Idle = defaultNetworkIdle
+			if val != nil && val != true {
+				ms, err := cast.ToFloat64E(val)
+				if err != nil {
+					return nil, fmt.Errorf("%s is not a number: %v", name, val)
+				}
+				cond.Idle = time.Duration(ms) * time.Millisecond
+			}
+		} else {
+			s, ok := val.(string)
+			if !ok || s == "" {
+				return nil, fmt.Errorf("%s is not a string: %v", name, val)
+			}
+			cond.Value = s
+		}
+		conds = append(conds, cond)
+	}
+	return conds, nil
+}
+
+// waitFor poll page until cond holds, errors while polling are ignored
+// because page may be navigating, the last one is reported when timeout
+func waitFor(page Page, cond waitCond) error {
+	if cond.Name == "waitForNetworkIdle" {
+		if p, ok := page.(networkIdler); ok {
+			return p.WaitNetworkIdle(cond.Idle, cond.Timeout)
+		}
+		return waitResourceIdle(page, cond)
+	}
+
+	var body string
+	args := map[string]interface{}{"value": cond.Value}
+	switch cond.Name {
+	case "waitForURLContains":
+		body = "return window.location.href.indexOf(value) !== -1;"
+	case "waitForSelector":
+		body = "return document.querySelector(value) !== null;"
+	case "waitForExpression":
+		body = "return !!(" + cond.Value + ");"
+		args = nil
+	}
+
+	var lastErr error
+	deadline := time.Now().Add(cond.Timeout)
+	for {
+		var ok bool
+		if lastErr = page.RunScript(body, args, &ok); lastErr == nil && ok {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return waitTimeoutError(cond, lastErr)
+		}
+		time.Sleep(waitPollInterval)
+	}
+}
+
+// waitResourceIdle wait until page is loaded and no more resource is fetched for idle
+func waitResourceIdle(page Page, cond waitCond) error {
+	const body = `var n = (window.performance && performance.getEntriesByType) ?
+		performance.getEntriesByType('resource').length : 0;
+	return [document.readyState, n];`
+
+	var lastErr error
+	var lastCount float64 = -1
+	var since time.Time
+	deadline := time.Now().Add(cond.Timeout)
+	for {
+		var state []interface{}
+		if lastErr = page.RunScript(body, nil, &state); lastErr == nil && len(state) == 2 {
+			count, _ := state[1].(float64)
+			if state[0] != "complete" || count != lastCount {
+				lastCount = count
+				since = time.Now()
+			} else if time.Since(since) >= cond.Idle {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return waitTimeoutError(cond, lastErr)
+		}
+		time.Sleep(waitPollInterval)
+	}
+}
+
+func waitTimeoutError(cond waitCond, lastErr error) error {
+	msg := fmt.Sprintf("%s %q not satisfied in %v", cond.Name, cond.Value, cond.Timeout)
+	if cond.Name == "waitForNetworkIdle" {
+		msg = fmt.Sprintf("%s: network not idle for %v in %v", cond.Name, cond.Idle, cond.Timeout)
+	}
+	if lastErr != nil {
+		msg += ", last error: " + lastErr.Error()
+	}
+	return newParseError(ErrWaitTimeout, fmt.Errorf("%s", msg))
+}
@@ -14,6 +14,7 @@ var (
 	fWebAddr    string
 	fWebDevMode bool
 	fWebRootDir string
+	fWebShotDir string
 )
 
 func init() {
@@ -21,6 +22,7 @@ func init() {
 	flags.StringVarP(&fWebAddr, "addr", "a", ":8080", "the server listen addr")
 	flags.BoolVarP(&fWebDevMode, "devMode", "D", false, "develop mode, using local assets")
 	flags.StringVarP(&fWebRootDir, "rootDir", "d", "./pub", "public dir for store demonstration file")
+	flags.StringVarP(&fWebShotDir, "screenshotDir", "s", "./output/screenshots", "dir of screenshots taken by crawl")
 }
 
 var WebCmd = &cobra.Command{
@@ -35,6 +37,7 @@ func web() error {
 	http.Handle("/", http.FileServer(http.Dir(fWebRootDir)))
 	http.Handle("/assets/", http.FileServer(assets.FS(fWebDevMode)))
 	http.Handle("/proxy", newImgProxy())
+	http.Handle("/screenshots/", http.StripPrefix("/screenshots/", http.FileServer(http.Dir(fWebShotDir))))
 
 	return http.ListenAndServe(fWebAddr, nil)
 }
@@ -3001,25 +3001,26 @@ vyP+B7/TXtharlToszq6MBCbAOHZ9kL2R64vuaSyyb//gP2I3fGP+hgn7cO+pf2XXdTVWrGJom6kabFJ
 
 	"/assets/templates/layout.tmpl": {
 		local:   "assets/templates/layout.tmpl",
-		size:    2912,
-		modtime: 1479375452,
+		size:    3249,
+		modtime: 1792205208,
 		compressed: `
-H4sIAAAJbogA/6yW32+juBPA3/NXzNfqVyK6Amn3VtpLIPewt7qrdFJX10qne6ocPIBbY7O2kyaH+N9P
-hlCSFNputTwkNjP+zNjzw1QVw5RLBJIjZagJ+HU9if732/Xn23++foHcFmI5ido/AIDI6bXDZlqgpZBb
-W/r4bc03MfmspEVp/dtdiQSSdhYTi1sbOswCkpxqgzZe29T/RE5ZnZQMiyUtMCYbjo+l0vbAwCNnNo8Z
-bniCfjM5By655VT4JqEC44tgdoiz3ApcfhHcYBS2k14ouHwAjSImxu4EmhzREsg1pjEJqTFoTdhLTLhS
-yhqraRkUXAaJMeRHwHybY4FDyEYd7K7E/dEey90TJEr4vMigKiljXGbzj+UWPpbbRT2sF/Ai8xMU4mmF
-v1LWqmJ+MZv9fwE58iy389kC1AZ1KtTjPOeMoVzAiiYPmVZryeags5V3+fOn88vLX84vZx+mB+aidpv7
-TAr7VIpWiu0gEdSYmLiQUi5RH26Y8Q1wFpOCckk6TcGN9Z3dkiwnVYWS1fVk0uc0t1i0GX244Ya1J2j1
-eHJspxq9DeiHviNDSSWK9tcvNS+o3g3AxoEHFN+dBZfZyPq3uf2kSTu9lt0kN7gwb41/cUHAUp25Ertb
-CSofulSsquBa8+zPr3VNllUV3LpldR2F9L2mXrDUWhnlNmxTUtnhM7Erc54oCU8jP1cFkmUUOr0XXHzR
-/5DxzUjMxkVV5YOmMkMIbn6/ETzBkxR7YozH/YdE+sSZqyK7sliYEW+G+PtQfYB9F3jF2OnyrmW8YVmz
-1PWZpgfsG3bbWvqCpv/uCDBqqa80z7ikosmWG53UNQFXZG1vb97+7UZP79v21Aj+aIZO0ijvRb6mlqtG
-4S83ejUB4eUs+A4VF6O2O70D8koiDnMHFu1fDfTJVCnb3f0jgMgkmpcWjE76S+uebmj73oT339aod81d
-dW+aqmwE30E4vkPfCXEZJBRlb2Ac3J49gYx/gLjnzEvXMrFcSW8K1bNTP/NcRQRNGk8DJT1y1zl0R8sS
-qSbn0BOeA9zDU/DOPJtzMw2otdojRidkGnDJcHudesTVx5wXNMOwlNmCTGEZz4bc6Z4N1aAEMzqBGI7R
-R7VGposXGRIfWwYJS622u1+79g4/7fnj6zuza7niknkEtVaaHO7wfM+fDjKep3g94O1xALqz94aPBtMU
-EzsHklKGV5K8auFwfpxXUei+YJaTKGw/lbsi+y8AAP//feh5Y2ALAAA=
+H4sIAAAJbogA/6yXX2/bNhDA3/0pbkQH2Fgk2ekKdLbkPXTFVmBAiiXAsKeAlk4SE4pUSdqxR+i7D9Sf
+WPbkOEmTh4Tk3f2OPN6dGGsTTJlAIDnSBBUBr6pG4Q+/XX26+efrZ8hNwZejsPkDABA6vWZYTws0FHJj
+Sg+/rdkmIp+kMCiMd7MrkUDczCJicGsCh1lAnFOl0URrk3ofyTGrk5JhsaAFRmTD8KGUyvQcPLDE5FGC
+GxajV08ugAlmGOWejinHaOZP+zjDDMflZ840hkEz2Qs5E/egkEdEmx1HnSMaArnCNCIB1RqNDvYSHayk
+NNooWvoFE36sNXkLmGdyLHAIWauD2ZXYhvZQDgDgx5J7rMjAljRJmMjmH8otfCi3i2pYz2dF5sXI+aOF
+t5LGyGI+m05/XECOLMvNfLoAuUGVcvkwz1mSoFjAisb3mZJrkcxBZavx5c8fLy4vf7m4nL6f9NyFzTHb
+TAr2qRSuZLKDmFOtI+KulDKBqn/ghG2AJREpKBOk0+RMG8/5LclyZC2KpKpGo31OM4NFk9HQ+6lZLUHJ
+h6OwHWvsfcB+6DkylFQgb357pWIFVbsB2Glgj+K5WDCRnbB/3rYfNWmn17Dr5AZ3zVvtWctS8K9jhSh0
+Lk1VzabWItdYVbNZG0QChqrMVeHtilNx32Wrtf6VYtmfX6uKLK31bxy5qsKAnt6NtR4cu3zd1menthVY
+e4AnUNtFRD8uPhEuAIBQl1R0rjO+K3MWSwGPI69ksVkrJMswcKpPBP9cLJosfdsAWOs3d/J9h8xl8b0n
+DIOEbZajF4pcXBQVGYJ//fs1ZzGeCNEThfQmpXO0mS9F9sVgoavqSYs+v72q99C21TPOjs27HvwMMwCA
+0DXuuqm2X8CmV+87JP13RyChhnpSsYwJyutsuVaxKxPXtZqPZb36txs9rjf9vhb8UQ+dpFZuRZ6ihsla
+4S83OpuAZ7LgBSrPKKRXJ+Iwd8CoXRr48KRSmu4xdQIQ6lix0oBW8f4VcEc3tFnXwd23Napd/fG/03VV
+1oIXEA4fJa+EuAzikibPYPSeI3sCOf2iAwB4N07XIjZMivEE7IGoEbuK8Os0nvhSjMltt6FbWpZIFbmA
+PcEOXipLYfxubHKmJz41Ro2JVjGZ+EwkuL1Kx8TVx5wVNMOgFNmCTGAZTScwTAMA2FAFkidaxRDBIfqg
+1shk8SRD4EPDIEGp5Hb3a9fe4aeWf9q+c7sWKyaSMUGlpCL9E160/Mkg4/8pXk0WZy6gi/14ODSYphib
+OZCUJvhFkLMe+vPDvAoD9yRcjsKg+d+jK7L/BgCNTl0lsQwAAA==
 `,
 	},
 
@@ -190,24 +190,30 @@ var _escData = map[string]*_escFile{
 
 	"/conf/crawl.yml": {
 		local:   "conf/crawl.yml",
-		size:    611,
-		modtime: 1476767479,
+		size:    871,
+		modtime: 1792206955,
 		compressed: `
-H4sIAAAJbogA/5TSzUpDMRAF4H2eYlYuhHtBCiKhO+lCsHbhAwwxHTWSPycT/Hl6MVSJNVzo9s45536L
-TNOkyLtCaFMIKWo429ze3G/werfd7u4UwL6GjM8SvAbhSgqgWHZZMJpAWgEATNBPYGbKhml+KcOr4dJu
-H/5T5sq+6KNNaJfWTlVyFXx0/uezvIsCcE8xMR1ED85E70zEt+/fRBIyhYbLB8+4kHvyOPLfNM4tIbM9
-idjFx8AusMDrUgNcwwubPeHV6pe1Xms4P3oNf2qvMcwXl6vZprBQ+goAAP//nI58zWMCAAA=
+H4sIAAAJbogA/6STz47aMBDG736KOfVQKdHuIlWVtbfVHiqVcugDWMYZiMH/Oh4XwtNXSQABDVTVHuP5
+fjPzfaNUVSXQ2YzKRO9jkPDp/fu3n+/qbTGfL34IgKb4pFr2TgJTQQGw1Ga7plhCo6zXa8znSjZkE6ug
+PUoBAFDBZXOVNGWsN1l07sB1IZflDQVDZZMFQCycCquVdadn3rMAsOsQCY8zl1YHZ3VQu35MQEadcbLz
+cZ9pIBGOQ+9L/t5pWjcu2eBva1CCTW0MKABcNLqHDm311scakHeRthJM9EmbnmljZmViMIUIg+kkzE6v
+pBklvAgAQqZuNOP1Xmlm9InzqB1vE1crCc9Po52NZUaS8FS/DN8Dr2IYWwD0dKcIc3F8vuN0xMn8V8DJ
+/CPeC8GDcJO5E22DecsxfSDLK5vDEZl0g+rr7Gzw9VXC55s/4gr7FXz9/GVWm+gfQH8GAIh5c9JnAwAA
 `,
 	},
 
 	"/conf/pic.yml": {
 		local:   "conf/pic.yml",
-		size:    135,
-		modtime: 1480927434,
+		size:    554,
+		modtime: 1792207149,
 		compressed: `
-H4sIAAAJbogA/9LV1eVKyklMzo4vzy9KKY7PzIsvySzJSbXiUlDQVXi6bsbzvRNhzGfTdj7fO/H56plg
-gRcbe15sbHvROwsiPWeFgmNBgUJwSX5RqsKTHV3PZ7U8bWt9um4nV0F+cUl8SVFmbnxBUWpaZkV8cWla
-WmaFlYKSgu77PbPe72lU4gIEAAD//0ICST+HAAAA
+H4sIAAAJbogA/1xQwYoTQRC9z1c8NpddmIHkojI3v8GjSNOZrskUznQPXTUm8SboHkQPexENfoAgLOzN
+hd2/MSa3/QXpyQiyt1evqt57vKIosmVrq9dmHaITw94oa0tlBhTYX3893F/9g3++3B7urw4/v43E8ebT
+8eby+Hl3Wn//ged9jxcaIuH3r4+H3fv95Yf99W3WB1GjkTvTR6p5Y2Soa96UOEPxcLd7uHt3ls3AnV0R
+VjEMvcBGgoSo5LDcYk28ahKWoUOoUZPVIZKUqMLgNU/nFufssZjPN4v5HD1vqJWLPJvBLsMbMnVoXY5o
+lYOpghcWJV9tc4jtyDRBdIIudJY9zutoK+Xgk98YTS5gvYOjXptMqhDHipJuiadPnmWYYkqicUpWYpES
+qEZeDkqCJrSO/QraECLZFhKr5NDat9vJJh+XNUdRBE9Ys5cc3nYkIO+wZm2yWXoU0rGo3kYhBysTmSU1
+k1ylxEtn1RYh8oq9bXOMo8RqQun0v/EkkOMRPcT2VfZ3ANwzKo0qAgAA
 `,
 	},
 